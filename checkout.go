@@ -0,0 +1,272 @@
+package session
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "time"
+)
+
+// DiffWriter is implemented by providers which can persist only the keys
+// changed during a checkout, in one round trip
+type DiffWriter interface {
+    WriteDiff(sid string, set map[interface{}]interface{}, deleted []interface{}) error
+}
+
+// checkedOut buffer the changes made to a session between Checkout and Checkin
+type checkedOut struct {
+    lock      sync.Mutex
+    inner     Session
+    base      map[interface{}]interface{} // values at checkout, nil if inner isn't a Snapshotter
+    set       map[interface{}]interface{}
+    modified  map[interface{}]time.Time
+    deleted   map[interface{}]bool
+    transient map[interface{}]interface{}
+    release   func()                      // unlock the sid for the next Checkout, nil unless SetSerializeWrites
+}
+
+func (st *checkedOut) SetTransient(key, value interface{}) {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if st.transient == nil {
+        st.transient = make(map[interface{}]interface{})
+    }
+    st.transient[key] = value
+}
+
+func (st *checkedOut) Set(key, value interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    delete(st.transient, key)
+    st.set[key] = value
+    st.modified[key] = time.Now()
+    delete(st.deleted, key)
+    return nil
+}
+
+func (st *checkedOut) Get(key interface{}) interface{} {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    return st.get(key)
+}
+
+func (st *checkedOut) get(key interface{}) interface{} {
+    if v, ok := st.transient[key]; ok {
+        return v
+    }
+    if st.deleted[key] {
+        return nil
+    }
+    if v, ok := st.set[key]; ok {
+        return v
+    }
+    if st.base != nil {
+        return st.base[key]
+    }
+    return st.inner.Get(key)
+}
+
+func (st *checkedOut) Delete(key interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    st.delete(key)
+    return nil
+}
+
+func (st *checkedOut) delete(key interface{}) {
+    delete(st.transient, key)
+    delete(st.set, key)
+    delete(st.modified, key)
+    st.deleted[key] = true
+}
+
+func (st *checkedOut) Rename(oldKey, newKey interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    v := st.get(oldKey)
+    if v == nil {
+        return nil
+    }
+    st.delete(oldKey)
+    st.set[newKey] = v
+    st.modified[newKey] = time.Now()
+    delete(st.deleted, newKey)
+    return nil
+}
+
+func (st *checkedOut) KeyModifiedAt(key interface{}) (time.Time, bool) {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if t, ok := st.modified[key]; ok {
+        return t, true
+    }
+    if st.deleted[key] {
+        return time.Time{}, false
+    }
+    return st.inner.KeyModifiedAt(key)
+}
+
+func (st *checkedOut) Snapshot() map[interface{}]interface{} {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    values := make(map[interface{}]interface{}, len(st.base))
+    for k, v := range st.base {
+        values[k] = v
+    }
+    for k := range st.deleted {
+        delete(values, k)
+    }
+    for k, v := range st.set {
+        values[k] = v
+    }
+    return values
+}
+
+func (st *checkedOut) SessionID() string {
+    return st.inner.SessionID()
+}
+
+// per sid mutexes, an entry lives while someone holds or waits for it
+type sidLocks struct {
+    lock  sync.Mutex
+    locks map[string]*sidLock
+}
+
+type sidLock struct {
+    sync.Mutex
+    refs int
+}
+
+// block until sid is free, the returned func frees it again
+func (l *sidLocks) acquire(sid string) func() {
+    l.lock.Lock()
+    if l.locks == nil {
+        l.locks = make(map[string]*sidLock)
+    }
+    sl := l.locks[sid]
+    if sl == nil {
+        sl = &sidLock{}
+        l.locks[sid] = sl
+    }
+    sl.refs++
+    l.lock.Unlock()
+
+    sl.Lock()
+    return func() {
+        sl.Unlock()
+        l.lock.Lock()
+        if sl.refs--; sl.refs == 0 {
+            delete(l.locks, sid)
+        }
+        l.lock.Unlock()
+    }
+}
+
+// make Checkout of a sid wait until the previous checkout of it is checked in,
+// so concurrent handlers modifying one session queue instead of overwriting
+// each other. a session which is never checked in blocks its sid for good
+func (manager *Manager) SetSerializeWrites(serialize bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.serializeWrites = serialize
+}
+
+// Checkout read the session sid and return it with changes held back until
+// Checkin, so a network provider sees one read and at most one write
+func (manager *Manager) Checkout(sid string) (Session, error) {
+    manager.lock.Lock()
+    serialize := manager.serializeWrites
+    manager.lock.Unlock()
+    var release func()
+    if serialize {
+        // wait outside the manager lock, Checkin needs it
+        release = manager.writeLocks.acquire(sid)
+    }
+    st, err := manager.checkout(sid)
+    if err != nil {
+        if release != nil {
+            release()
+        }
+        return nil, err
+    }
+    st.release = release
+    return st, nil
+}
+
+func (manager *Manager) checkout(sid string) (*checkedOut, error) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    session, err := manager.sessionRead(context.Background(), sid)
+    if err != nil {
+        return nil, err
+    }
+    if session != nil && manager.dropRevoked(session) {
+        return nil, manager.wrapSIDError(sid, ErrRevoked)
+    }
+    return newCheckedOut(session), nil
+}
+
+func newCheckedOut(session Session) *checkedOut {
+    st := &checkedOut{inner: session, set: make(map[interface{}]interface{}),
+        modified: make(map[interface{}]time.Time), deleted: make(map[interface{}]bool)}
+    if snap, ok := unwrapSession(session).(Snapshotter); ok {
+        st.base = snap.Snapshot()
+    }
+    return st
+}
+
+// Checkin persist the changes made to a session from Checkout. nothing is
+// written when nothing changed, only the changed keys when the provider is a DiffWriter.
+// with SetSerializeWrites the first Checkin lets the next Checkout of the sid go on
+func (manager *Manager) Checkin(s Session) error {
+    st, ok := s.(*checkedOut)
+    if !ok {
+        return errors.New("session: Checkin of a session not from Checkout")
+    }
+    // manager.lock before st.lock, the order of session calls made by the manager
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if st.release != nil {
+        defer st.release()
+        st.release = nil
+    }
+    if len(st.set) == 0 && len(st.deleted) == 0 {
+        return nil
+    }
+
+    if dw, ok := manager.provider.(DiffWriter); ok {
+        sid := st.inner.SessionID()
+        if err := dw.WriteDiff(manager.storeKey(sid), st.set, st.deletedKeys()); err != nil {
+            return manager.wrapSIDError(sid, err)
+        }
+    } else if err := applyChanges(st.inner, st.set, st.deletedKeys()); err != nil {
+        return err
+    }
+    st.settle()
+    return nil
+}
+
+func (st *checkedOut) deletedKeys() []interface{} {
+    deleted := make([]interface{}, 0, len(st.deleted))
+    for k := range st.deleted {
+        deleted = append(deleted, k)
+    }
+    return deleted
+}
+
+// fold the written changes into base and start buffering anew, caller must hold the lock
+func (st *checkedOut) settle() {
+    if st.base != nil {
+        for k := range st.deleted {
+            delete(st.base, k)
+        }
+        for k, v := range st.set {
+            st.base[k] = v
+        }
+    }
+    st.set = make(map[interface{}]interface{})
+    st.modified = make(map[interface{}]time.Time)
+    st.deleted = make(map[interface{}]bool)
+}
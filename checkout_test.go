@@ -0,0 +1,201 @@
+package session
+
+import (
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+// diffProvider is a fakeProvider which is a DiffWriter, recording the diffs
+type diffProvider struct {
+    *fakeProvider
+    diffs []map[interface{}]interface{}
+}
+
+func (p *diffProvider) WriteDiff(sid string, set map[interface{}]interface{}, deleted []interface{}) error {
+    diff := make(map[interface{}]interface{}, len(set)+len(deleted))
+    for k, v := range set {
+        diff[k] = v
+    }
+    for _, k := range deleted {
+        diff[k] = nil
+    }
+    p.diffs = append(p.diffs, diff)
+    return applyChanges(p.stored(sid), set, deleted)
+}
+
+func TestCheckoutBuffersUntilCheckin(t *testing.T) {
+    manager, p := newTestManager(t)
+    s, _ := startNew(t, manager)
+    s.Set("keep", "v")
+    s.Set("drop", "v")
+
+    out, err := manager.Checkout(s.SessionID())
+    if err != nil {
+        t.Fatalf("Checkout: %v", err)
+    }
+    out.Set("user", "alice")
+    out.Delete("drop")
+    if out.Get("user") != "alice" || out.Get("drop") != nil || out.Get("keep") != "v" {
+        t.Fatalf("checked out values = %v", out.(Snapshotter).Snapshot())
+    }
+    stored := p.stored(s.SessionID())
+    if stored.Get("user") != nil || stored.Get("drop") != "v" {
+        t.Fatal("changes reached the provider before Checkin")
+    }
+
+    if err := manager.Checkin(out); err != nil {
+        t.Fatalf("Checkin: %v", err)
+    }
+    if stored.Get("user") != "alice" || stored.Get("drop") != nil || stored.Get("keep") != "v" {
+        t.Fatalf("stored values after Checkin = %v", stored.Snapshot())
+    }
+}
+
+func TestCheckinWritesDiff(t *testing.T) {
+    p := &diffProvider{fakeProvider: newFakeProvider()}
+    manager := newManagerOn(t, p)
+    s, _ := startNew(t, manager)
+    s.Set("keep", "v")
+    s.Set("drop", "v")
+
+    out, err := manager.Checkout(s.SessionID())
+    if err != nil {
+        t.Fatalf("Checkout: %v", err)
+    }
+    if err := manager.Checkin(out); err != nil {
+        t.Fatalf("Checkin without changes: %v", err)
+    }
+    if len(p.diffs) != 0 {
+        t.Fatalf("unchanged checkout wrote %v", p.diffs)
+    }
+
+    out.Set("user", "alice")
+    out.Delete("drop")
+    if err := manager.Checkin(out); err != nil {
+        t.Fatalf("Checkin: %v", err)
+    }
+    want := map[interface{}]interface{}{"user": "alice", "drop": nil}
+    if len(p.diffs) != 1 || len(p.diffs[0]) != len(want) || p.diffs[0]["user"] != "alice" {
+        t.Fatalf("diffs = %v, want only %v", p.diffs, want)
+    }
+    if _, ok := p.diffs[0]["drop"]; !ok {
+        t.Fatalf("diff %v misses the deleted key", p.diffs[0])
+    }
+
+    // the written changes are settled, a second Checkin has nothing to write
+    if err := manager.Checkin(out); err != nil || len(p.diffs) != 1 {
+        t.Fatalf("second Checkin = %v with diffs %v", err, p.diffs)
+    }
+}
+
+func TestCheckinOfForeignSession(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, _ := startNew(t, manager)
+    if err := manager.Checkin(s); err == nil {
+        t.Fatal("Checkin accepted a session not from Checkout")
+    }
+}
+
+// run with -race: Checkin and the manager lock the session in the same order
+func TestCheckinConcurrentWithManager(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, c := startNew(t, manager)
+    out, err := manager.Checkout(s.SessionID())
+    if err != nil {
+        t.Fatalf("Checkout: %v", err)
+    }
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(2)
+        go func(i int) {
+            defer wg.Done()
+            out.Set("n", i)
+            manager.Checkin(out)
+        }(i)
+        go func() {
+            defer wg.Done()
+            manager.SessionStart(httptest.NewRecorder(), requestWith(c))
+        }()
+    }
+    wg.Wait()
+    if s.Get("n") == nil {
+        t.Fatal("no checkin reached the session")
+    }
+}
+
+func TestCheckoutSetTransient(t *testing.T) {
+    p := &diffProvider{fakeProvider: newFakeProvider()}
+    manager := newManagerOn(t, p)
+    s, _ := startNew(t, manager)
+    out, _ := manager.Checkout(s.SessionID())
+    out.SetTransient("request", "r1")
+    if out.Get("request") != "r1" {
+        t.Fatal("transient value not readable from the checkout")
+    }
+    if _, ok := out.(Snapshotter).Snapshot()["request"]; ok {
+        t.Fatal("transient value in the snapshot")
+    }
+    if err := manager.Checkin(out); err != nil || len(p.diffs) != 0 {
+        t.Fatalf("Checkin of only a transient value = %v, wrote %v", err, p.diffs)
+    }
+}
+
+// run with -race
+func TestSerializeWrites(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetSerializeWrites(true)
+    s, _ := startNew(t, manager)
+    s.Set("n", 0)
+
+    var wg sync.WaitGroup
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            out, err := manager.Checkout(s.SessionID())
+            if err != nil {
+                t.Errorf("Checkout: %v", err)
+                return
+            }
+            out.Set("n", out.Get("n").(int)+1)
+            if err := manager.Checkin(out); err != nil {
+                t.Errorf("Checkin: %v", err)
+            }
+        }()
+    }
+    wg.Wait()
+    if got := s.Get("n"); got != 10 {
+        t.Fatalf("n = %v after 10 serialized increments, want 10", got)
+    }
+}
+
+func TestSerializeWritesBlocksCheckout(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetSerializeWrites(true)
+    s, _ := startNew(t, manager)
+    first, err := manager.Checkout(s.SessionID())
+    if err != nil {
+        t.Fatalf("Checkout: %v", err)
+    }
+    first.Set("step", "first")
+
+    second := make(chan Session)
+    go func() {
+        out, _ := manager.Checkout(s.SessionID())
+        second <- out
+    }()
+    select {
+    case <-second:
+        t.Fatal("second Checkout returned before the first was checked in")
+    case <-time.After(50 * time.Millisecond):
+    }
+    manager.Checkin(first)
+    out := <-second
+    if got := out.Get("step"); got != "first" {
+        t.Fatalf("second checkout sees step %v, want the first checkin", got)
+    }
+    manager.Checkin(out)
+}
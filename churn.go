@@ -0,0 +1,66 @@
+package session
+
+import "time"
+
+// seconds covered by ChurnRate
+const churnWindow = 60
+
+// session creations counted per second over the last churnWindow seconds
+type churnCounter struct {
+    counts [churnWindow]uint64
+    stamps [churnWindow]int64 // second each count belongs to
+}
+
+func (c *churnCounter) add(now time.Time) {
+    sec := now.Unix()
+    i := sec % churnWindow
+    if c.stamps[i] != sec {
+        c.stamps[i] = sec
+        c.counts[i] = 0
+    }
+    c.counts[i]++
+}
+
+func (c *churnCounter) rate(now time.Time) float64 {
+    sec := now.Unix()
+    var total uint64
+    for i, stamp := range c.stamps {
+        if stamp > sec-churnWindow && stamp <= sec {
+            total += c.counts[i]
+        }
+    }
+    return float64(total) / churnWindow
+}
+
+// ChurnRate return the sessions created per second, averaged over the last minute.
+// a rate far above normal usually means an attack or clients not sending the cookie back
+func (manager *Manager) ChurnRate() float64 {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    return manager.churn.rate(manager.now())
+}
+
+// set a callback invoked when ChurnRate climbs past rate. it fires once per
+// crossing, again only after the rate dropped below. f is called with the
+// lock held and must not call back into the manager. nil f removes the alert
+func (manager *Manager) SetChurnAlert(rate float64, f func()) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.churnAlertRate = rate
+    manager.churnAlert = f
+    manager.churnAlerted = false
+}
+
+// count a created session and check the alert, caller must hold the lock
+func (manager *Manager) recordChurn() {
+    now := manager.now()
+    manager.churn.add(now)
+    if manager.churnAlert == nil {
+        return
+    }
+    over := manager.churn.rate(now) > manager.churnAlertRate
+    if over && !manager.churnAlerted {
+        manager.churnAlert()
+    }
+    manager.churnAlerted = over
+}
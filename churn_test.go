@@ -0,0 +1,41 @@
+package session
+
+import (
+    "testing"
+    "time"
+)
+
+func TestChurnRate(t *testing.T) {
+    manager, _ := newTestManager(t)
+    now := time.Unix(1700000000, 0)
+    manager.SetClock(func() time.Time { return now })
+    alerts := 0
+    manager.SetChurnAlert(1.5, func() { alerts++ })
+
+    start := func(n int) {
+        for i := 0; i < n; i++ {
+            startNew(t, manager)
+        }
+    }
+    start(60)
+    now = now.Add(30 * time.Second)
+    start(60)
+    if got := manager.ChurnRate(); got != 2 {
+        t.Fatalf("ChurnRate = %v, want 120 creations over 60 seconds", got)
+    }
+    if alerts != 1 {
+        t.Fatalf("alert fired %d times, want once for the crossing", alerts)
+    }
+
+    // the first 60 fall out of the window
+    now = now.Add(31 * time.Second)
+    if got := manager.ChurnRate(); got != 1 {
+        t.Fatalf("ChurnRate a minute later = %v, want 1", got)
+    }
+    start(1)
+    now = now.Add(time.Minute)
+    start(100)
+    if alerts != 2 {
+        t.Fatalf("alert fired %d times, want again after the rate dropped", alerts)
+    }
+}
@@ -0,0 +1,53 @@
+package session
+
+import (
+    "net/http"
+    "reflect"
+)
+
+// RequireClaims report whether every key is set in s to a truthy value:
+// not nil, false, a zero number, "", "0" or "false"
+func (manager *Manager) RequireClaims(s Session, keys ...string) bool {
+    for _, key := range keys {
+        if !truthy(s.Get(key)) {
+            return false
+        }
+    }
+    return true
+}
+
+// RequireClaimsHandler behave like RequireSession, and answer 403 when the
+// session lacks one of the claims, see RequireClaims
+func (manager *Manager) RequireClaimsHandler(next http.Handler, keys ...string) http.Handler {
+    return manager.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        session, ok := FromContext(r.Context())
+        if !ok && manager.skipped(r) {
+            next.ServeHTTP(w, r)
+            return
+        }
+        if !manager.RequireClaims(session, keys...) {
+            http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+            return
+        }
+        next.ServeHTTP(w, r)
+    }))
+}
+
+func truthy(v interface{}) bool {
+    if v == nil {
+        return false
+    }
+    // by kind, so float64 claims decoded from JSON and named types count too
+    switch rv := reflect.ValueOf(v); rv.Kind() {
+    case reflect.Bool:
+        return rv.Bool()
+    case reflect.String:
+        s := rv.String()
+        return s != "" && s != "0" && s != "false"
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+        reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+        return !rv.IsZero()
+    }
+    return true
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestRequireClaims(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s := newTransientSession("t")
+    for _, v := range []interface{}{nil, false, 0, int64(0), uint(0), uint8(0), float64(0), "", "0", "false"} {
+        s.Set("admin", v)
+        if manager.RequireClaims(s, "admin") {
+            t.Errorf("claim %#v counted as set", v)
+        }
+    }
+    for _, v := range []interface{}{true, 1, int64(2), uint(1), 0.5, "yes", []string{"x"}} {
+        s.Set("admin", v)
+        if !manager.RequireClaims(s, "admin") {
+            t.Errorf("claim %#v counted as unset", v)
+        }
+    }
+    s.Set("verified", true)
+    if manager.RequireClaims(s, "admin", "verified", "missing") {
+        t.Error("RequireClaims passed with a missing claim")
+    }
+}
+
+// claims decoded from JSON, e.g. a token payload, are float64
+func TestRequireClaimsJSON(t *testing.T) {
+    manager, _ := newTestManager(t)
+    var claims map[string]interface{}
+    if err := json.Unmarshal([]byte(`{"admin": 0, "verified": 1}`), &claims); err != nil {
+        t.Fatalf("Unmarshal: %v", err)
+    }
+    s := newTransientSession("t")
+    for k, v := range claims {
+        s.Set(k, v)
+    }
+    if manager.RequireClaims(s, "admin") {
+        t.Error("JSON claim 0 counted as set")
+    }
+    if !manager.RequireClaims(s, "verified") {
+        t.Error("JSON claim 1 counted as unset")
+    }
+}
+
+func TestRequireClaimsHandler(t *testing.T) {
+    manager, _ := newTestManager(t)
+    var called bool
+    h := manager.RequireClaimsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }), "admin")
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, requestWith())
+    if rec.Code != http.StatusUnauthorized || called {
+        t.Fatalf("no session answered %d, want 401", rec.Code)
+    }
+
+    s, c := startNew(t, manager)
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, requestWith(c))
+    if rec.Code != http.StatusForbidden || called {
+        t.Fatalf("session without the claim answered %d, want 403", rec.Code)
+    }
+
+    s.Set("admin", true)
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, requestWith(c))
+    if rec.Code != http.StatusOK || !called {
+        t.Fatalf("session with the claim answered %d, next called %v", rec.Code, called)
+    }
+}
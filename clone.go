@@ -0,0 +1,43 @@
+package session
+
+import (
+    "context"
+)
+
+// CloneSession create a session with a new sid holding a deep copy of the
+// non reserved values of src, e.g. to seed a user from a template session.
+// the copy is made by a round trip through the manager codec, so values must
+// be encodable by it. src is left untouched
+func (manager *Manager) CloneSession(src Session) (Session, error) {
+    snap, ok := unwrapSession(src).(Snapshotter)
+    if !ok {
+        return nil, errNoSnapshot
+    }
+    values := snap.Snapshot()
+    for k := range values {
+        if isReserved(k) {
+            delete(values, k)
+        }
+    }
+    data, err := manager.codec.Encode(values)
+    if err != nil {
+        return nil, err
+    }
+    values, err = manager.codec.Decode(data)
+    if err != nil {
+        return nil, err
+    }
+
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    session, err := manager.createSession(context.Background())
+    if err != nil {
+        return nil, err
+    }
+    for k, v := range values {
+        if err := session.Set(k, v); err != nil {
+            return nil, err
+        }
+    }
+    return session, nil
+}
@@ -0,0 +1,33 @@
+package session
+
+import "testing"
+
+func TestCloneSession(t *testing.T) {
+    manager, p := newTestManager(t)
+    src := manager.ApiSessionCreate()
+    src.Set("tags", []string{"a", "b"})
+    src.Set(keyUserID, "alice")
+
+    clone, err := manager.CloneSession(src)
+    if err != nil {
+        t.Fatalf("CloneSession: %v", err)
+    }
+    if clone.SessionID() == src.SessionID() || p.stored(clone.SessionID()) == nil {
+        t.Fatal("clone is not a new stored session")
+    }
+    tags, _ := clone.Get("tags").([]string)
+    if len(tags) != 2 || tags[0] != "a" {
+        t.Fatalf("cloned tags = %v, want [a b]", clone.Get("tags"))
+    }
+    if clone.Get(keyUserID) != nil {
+        t.Fatal("reserved key was cloned")
+    }
+    if clone.Get(keyCreatedAt) == nil {
+        t.Fatal("clone has no creation time of its own")
+    }
+
+    tags[0] = "changed"
+    if src.Get("tags").([]string)[0] != "a" {
+        t.Fatal("clone shares values with src")
+    }
+}
@@ -0,0 +1,188 @@
+package session
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/binary"
+    "encoding/gob"
+    "errors"
+    "fmt"
+    "hash/crc32"
+    "io"
+)
+
+// Codec convert session values to bytes and back, used by providers
+// which keep sessions outside of process memory
+type Codec interface {
+    Encode(values map[interface{}]interface{}) ([]byte, error)
+    Decode(data []byte) (map[interface{}]interface{}, error)
+}
+
+// GobCodec encode session values with encoding/gob.
+// custom value types must be registered with gob.Register
+type GobCodec struct{}
+
+func (c GobCodec) Encode(values map[interface{}]interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func (c GobCodec) Decode(data []byte) (map[interface{}]interface{}, error) {
+    values := make(map[interface{}]interface{})
+    if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&values); err != nil {
+        return nil, err
+    }
+    return values, nil
+}
+
+// set the codec the manager uses to measure sessions, default is GobCodec
+func (manager *Manager) SetCodec(c Codec) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.codec = c
+}
+
+// SessionSizeBytes report the length of s encoded with the manager codec,
+// nothing is persisted. s must implement Snapshotter
+func (manager *Manager) SessionSizeBytes(s Session) (int, error) {
+    snap, ok := unwrapSession(s).(Snapshotter)
+    if !ok {
+        return 0, errNoSnapshot
+    }
+    data, err := manager.codec.Encode(snap.Snapshot())
+    if err != nil {
+        return 0, err
+    }
+    return len(data), nil
+}
+
+// header byte of blobs written by CompressingCodec
+const (
+    flagPlain      byte = 0
+    flagCompressed byte = 1
+)
+
+// sessions encoded shorter than this are stored uncompressed by default
+const DefaultCompressThreshold = 1024
+
+// CompressingCodec gzip the output of Codec when it is at least Threshold
+// bytes long and compression actually saves space. a one byte header tells
+// Decode whether the blob was compressed, so both kinds can be read
+type CompressingCodec struct {
+    Codec     Codec // inner codec, GobCodec if nil
+    Threshold int   // DefaultCompressThreshold if 0
+}
+
+func (c CompressingCodec) inner() Codec {
+    if c.Codec == nil {
+        return GobCodec{}
+    }
+    return c.Codec
+}
+
+func (c CompressingCodec) Encode(values map[interface{}]interface{}) ([]byte, error) {
+    data, err := c.inner().Encode(values)
+    if err != nil {
+        return nil, err
+    }
+    threshold := c.Threshold
+    if threshold == 0 {
+        threshold = DefaultCompressThreshold
+    }
+    if len(data) >= threshold {
+        var buf bytes.Buffer
+        buf.WriteByte(flagCompressed)
+        zw := gzip.NewWriter(&buf)
+        if _, err := zw.Write(data); err != nil {
+            return nil, err
+        }
+        if err := zw.Close(); err != nil {
+            return nil, err
+        }
+        if buf.Len() < len(data)+1 {
+            return buf.Bytes(), nil
+        }
+    }
+    return append([]byte{flagPlain}, data...), nil
+}
+
+func (c CompressingCodec) Decode(data []byte) (map[interface{}]interface{}, error) {
+    if len(data) == 0 {
+        return nil, errors.New("session: empty blob")
+    }
+    switch data[0] {
+    case flagPlain:
+        return c.inner().Decode(data[1:])
+    case flagCompressed:
+        zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+        if err != nil {
+            return nil, err
+        }
+        defer zr.Close()
+        plain, err := io.ReadAll(zr)
+        if err != nil {
+            return nil, err
+        }
+        return c.inner().Decode(plain)
+    }
+    return nil, fmt.Errorf("session: unknown blob header %#x", data[0])
+}
+
+// returned by ChecksumCodec.Decode for blobs whose checksum doesn't match,
+// the manager destroys such sessions and reads them again
+var ErrCorrupt = errors.New("session: session data is corrupt")
+
+// ChecksumCodec append a CRC-32 of the output of Codec and verify it in Decode,
+// to detect silent corruption in the store
+type ChecksumCodec struct {
+    Codec Codec // inner codec, GobCodec if nil
+}
+
+func (c ChecksumCodec) inner() Codec {
+    if c.Codec == nil {
+        return GobCodec{}
+    }
+    return c.Codec
+}
+
+func (c ChecksumCodec) Encode(values map[interface{}]interface{}) ([]byte, error) {
+    data, err := c.inner().Encode(values)
+    if err != nil {
+        return nil, err
+    }
+    var sum [4]byte
+    binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+    return append(data, sum[:]...), nil
+}
+
+func (c ChecksumCodec) Decode(data []byte) (map[interface{}]interface{}, error) {
+    if len(data) < 4 {
+        return nil, ErrCorrupt
+    }
+    payload, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+    if crc32.ChecksumIEEE(payload) != sum {
+        return nil, ErrCorrupt
+    }
+    return c.inner().Decode(payload)
+}
+
+// IntegrityChecker is implemented by providers which can store a checksum
+// with every session and verify it on read, see ChecksumCodec
+type IntegrityChecker interface {
+    SetIntegrityCheck(check bool)
+}
+
+// set whether the provider checksums stored sessions, a session failing the
+// check is destroyed and recreated empty. the provider must be an
+// IntegrityChecker, otherwise this does nothing. set it before sessions are
+// stored, records written without checksum fail the check
+func (manager *Manager) SetIntegrityCheck(check bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    if checker, ok := manager.provider.(IntegrityChecker); ok {
+        checker.SetIntegrityCheck(check)
+    }
+}
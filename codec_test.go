@@ -0,0 +1,103 @@
+package session
+
+import (
+    mathrand "math/rand"
+    "strings"
+    "testing"
+)
+
+// codec producing a fixed blob, to tell which codec was used
+type fixedCodec []byte
+
+func (c fixedCodec) Encode(values map[interface{}]interface{}) ([]byte, error) {
+    return c, nil
+}
+
+func (c fixedCodec) Decode(data []byte) (map[interface{}]interface{}, error) {
+    return map[interface{}]interface{}{}, nil
+}
+
+func TestSessionSizeBytes(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s := manager.ApiSessionCreate()
+    s.Set("blob", strings.Repeat("x", 500))
+
+    data, _ := GobCodec{}.Encode(s.(Snapshotter).Snapshot())
+    if n, err := manager.SessionSizeBytes(s); err != nil || n != len(data) {
+        t.Fatalf("SessionSizeBytes = %d, %v, want %d", n, err, len(data))
+    }
+
+    manager.SetCodec(fixedCodec("abc"))
+    if n, _ := manager.SessionSizeBytes(s); n != 3 {
+        t.Fatalf("SessionSizeBytes with SetCodec = %d, want 3", n)
+    }
+
+    bare := struct{ Session }{s}
+    if _, err := manager.SessionSizeBytes(bare); err != errNoSnapshot {
+        t.Fatalf("SessionSizeBytes of a session without Snapshot = %v, want errNoSnapshot", err)
+    }
+}
+
+func TestCompressingCodec(t *testing.T) {
+    c := CompressingCodec{Threshold: 100}
+    small := map[interface{}]interface{}{"k": "v"}
+    large := map[interface{}]interface{}{"k": strings.Repeat("x", 1000)}
+
+    data, err := c.Encode(small)
+    if err != nil || data[0] != flagPlain {
+        t.Fatalf("small session encoded with header %#x, %v, want plain", data[0], err)
+    }
+    if got, err := c.Decode(data); err != nil || got["k"] != "v" {
+        t.Fatalf("decode small = %v, %v", got, err)
+    }
+
+    data, err = c.Encode(large)
+    plain, _ := GobCodec{}.Encode(large)
+    if err != nil || data[0] != flagCompressed || len(data) >= len(plain) {
+        t.Fatalf("large session encoded to %d bytes with header %#x, %v, want compressed below %d", len(data), data[0], err, len(plain))
+    }
+    if got, err := c.Decode(data); err != nil || got["k"] != large["k"] {
+        t.Fatalf("decode large = %v", err)
+    }
+
+    if _, err := c.Decode([]byte{7}); err == nil {
+        t.Fatal("Decode accepted an unknown header")
+    }
+    if _, err := c.Decode(nil); err == nil {
+        t.Fatal("Decode accepted an empty blob")
+    }
+}
+
+// random data doesn't shrink, it is kept plain above the threshold too
+func TestCompressingCodecIncompressible(t *testing.T) {
+    noise := make([]byte, 2000)
+    mathrand.New(mathrand.NewSource(1)).Read(noise)
+    c := CompressingCodec{Codec: fixedCodec(noise), Threshold: 10}
+    data, err := c.Encode(nil)
+    if err != nil {
+        t.Fatalf("Encode: %v", err)
+    }
+    if data[0] != flagPlain || len(data) != len(noise)+1 {
+        t.Fatalf("incompressible blob encoded to %d bytes with header %#x, want plain", len(data), data[0])
+    }
+}
+
+func TestChecksumCodec(t *testing.T) {
+    values := map[interface{}]interface{}{"user": "alice"}
+    data, err := ChecksumCodec{}.Encode(values)
+    if err != nil {
+        t.Fatalf("Encode: %v", err)
+    }
+    got, err := ChecksumCodec{}.Decode(data)
+    if err != nil || got["user"] != "alice" {
+        t.Fatalf("Decode = %v, %v", got, err)
+    }
+
+    data[len(data)/2] ^= 1
+    if _, err := (ChecksumCodec{}).Decode(data); err != ErrCorrupt {
+        t.Fatalf("Decode of a flipped bit = %v, want ErrCorrupt", err)
+    }
+    if _, err := (ChecksumCodec{}).Decode(data[:3]); err != ErrCorrupt {
+        t.Fatalf("Decode of a truncated blob = %v, want ErrCorrupt", err)
+    }
+}
@@ -0,0 +1,123 @@
+package session
+
+import (
+    "errors"
+    "net/http"
+    log "github.com/cihub/seelog"
+)
+
+// returned when SameSite=None is configured without an always Secure cookie, browsers reject such cookies
+var ErrSameSiteNoneInsecure = errors.New("session: SameSite=None requires a Secure cookie")
+
+// returned when a session is started over plain http with SetRequireTLS
+var ErrTLSRequired = errors.New("session: sessions require https")
+
+// SecureMode tell when the session cookie gets the Secure flag
+type SecureMode int
+
+const (
+    SecureNever  SecureMode = iota // never Secure
+    SecureAlways                   // always Secure
+    SecureAuto                     // Secure for https requests only, see isHTTPS
+)
+
+// set the Secure flag of the session cookie
+func WithSecure(secure bool) Option {
+    return WithSecureMode(secureModeOf(secure))
+}
+
+// set when the session cookie is Secure
+func WithSecureMode(mode SecureMode) Option {
+    return func(manager *Manager) {
+        manager.secureMode = mode
+    }
+}
+
+// set the SameSite mode of the session cookie
+func WithSameSite(mode http.SameSite) Option {
+    return func(manager *Manager) {
+        manager.sameSite = mode
+    }
+}
+
+func secureModeOf(secure bool) SecureMode {
+    if secure {
+        return SecureAlways
+    }
+    return SecureNever
+}
+
+// check that secure and mode form a cookie browsers accept
+func validateCookieFlags(secure SecureMode, mode http.SameSite) error {
+    if mode == http.SameSiteNoneMode && secure != SecureAlways {
+        return ErrSameSiteNoneInsecure
+    }
+    return nil
+}
+
+// set the Secure flag of the session cookie, fails when it would leave
+// SameSite=None on an insecure cookie
+func (manager *Manager) SetSecure(secure bool) error {
+    return manager.SetSecureMode(secureModeOf(secure))
+}
+
+// set when the session cookie is Secure, fails when it would leave
+// SameSite=None on a cookie which isn't always Secure
+func (manager *Manager) SetSecureMode(secure SecureMode) error {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    if err := validateCookieFlags(secure, manager.sameSite); err != nil {
+        return err
+    }
+    manager.secureMode = secure
+    return nil
+}
+
+// set the SameSite mode of the session cookie, SameSiteNoneMode is only
+// accepted when the cookie is always Secure
+func (manager *Manager) SetSameSite(mode http.SameSite) error {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    if err := validateCookieFlags(manager.secureMode, mode); err != nil {
+        return err
+    }
+    manager.sameSite = mode
+    return nil
+}
+
+// check whether r came over https, directly or through a proxy setting X-Forwarded-Proto
+func isHTTPS(r *http.Request) bool {
+    return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// whether the cookie sent in response to r is Secure. r is nil when there is
+// no request, SecureAuto then leaves the flag off so http clients can still
+// clear the cookie
+func (manager *Manager) cookieSecure(r *http.Request) bool {
+    switch manager.secureMode {
+    case SecureAlways:
+        return true
+    case SecureAuto:
+        return r != nil && isHTTPS(r)
+    }
+    return false
+}
+
+// set whether sessions may only be started over https, by r.TLS or an
+// X-Forwarded-Proto of https. otherwise SessionStart returns nil,
+// ApiSessionStart, SessionStartManual and Login ErrTLSRequired, Handler
+// answers 403 without calling next, and no cookie is set
+func (manager *Manager) SetRequireTLS(require bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.requireTLS = require
+}
+
+// report whether r may start a session, caller must hold the lock
+func (manager *Manager) tlsOK(r *http.Request) bool {
+    if manager.requireTLS && !isHTTPS(r) {
+        log.Warnf("refuse to start a session over plain http for %s", r.URL.Path)
+        return false
+    }
+    return true
+}
@@ -0,0 +1,112 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestSecureAndSameSite(t *testing.T) {
+    if _, err := NewManager("test", "sid", 3600, WithSameSite(http.SameSiteNoneMode), WithFallbackProvider(newFakeProvider())); err != ErrSameSiteNoneInsecure {
+        t.Fatalf("NewManager with SameSite=None and no Secure = %v, want ErrSameSiteNoneInsecure", err)
+    }
+
+    manager, _ := newTestManager(t, WithSecure(true), WithSameSite(http.SameSiteNoneMode))
+    _, c := startNew(t, manager)
+    if !c.Secure || c.SameSite != http.SameSiteNoneMode {
+        t.Fatalf("cookie Secure %v SameSite %v, want Secure with SameSite=None", c.Secure, c.SameSite)
+    }
+    if err := manager.SetSecure(false); err != ErrSameSiteNoneInsecure {
+        t.Fatalf("SetSecure(false) with SameSite=None = %v, want ErrSameSiteNoneInsecure", err)
+    }
+    if err := manager.SetSameSite(http.SameSiteStrictMode); err != nil {
+        t.Fatalf("SetSameSite: %v", err)
+    }
+    if err := manager.SetSecure(false); err != nil {
+        t.Fatalf("SetSecure(false) with SameSite=Strict: %v", err)
+    }
+    if err := manager.SetSameSite(http.SameSiteNoneMode); err != ErrSameSiteNoneInsecure {
+        t.Fatalf("SetSameSite(None) on an insecure cookie = %v, want ErrSameSiteNoneInsecure", err)
+    }
+    _, c = startNew(t, manager)
+    if c.Secure || c.SameSite != http.SameSiteStrictMode {
+        t.Fatalf("cookie Secure %v SameSite %v, want insecure Strict", c.Secure, c.SameSite)
+    }
+}
+
+func TestSecureAuto(t *testing.T) {
+    manager, _ := newTestManager(t, WithSecureMode(SecureAuto))
+    cases := []struct {
+        r      *http.Request
+        secure bool
+    }{
+        {httptest.NewRequest("GET", "https://example.com/", nil), true},
+        {httptest.NewRequest("GET", "http://example.com/", nil), false},
+        {func() *http.Request {
+            r := httptest.NewRequest("GET", "http://example.com/", nil)
+            r.Header.Set("X-Forwarded-Proto", "https")
+            return r
+        }(), true},
+    }
+    for _, c := range cases {
+        rec := httptest.NewRecorder()
+        s := manager.SessionStart(rec, c.r)
+        if got := responseCookie(rec, "sid"); got == nil || got.Secure != c.secure {
+            t.Errorf("%s %v: cookie %v, want Secure %v", c.r.URL, c.r.Header, got, c.secure)
+        }
+        rec = httptest.NewRecorder()
+        manager.SessionEnd(rec, s)
+        if got := responseCookie(rec, "sid"); got == nil || got.Secure {
+            t.Errorf("SessionEnd cookie %v, want it insecure so http clients clear it", got)
+        }
+    }
+
+    if err := manager.SetSameSite(http.SameSiteNoneMode); err != ErrSameSiteNoneInsecure {
+        t.Fatalf("SameSite=None with SecureAuto = %v, want ErrSameSiteNoneInsecure", err)
+    }
+}
+
+func TestRequireTLS(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetRequireTLS(true)
+
+    rec := httptest.NewRecorder()
+    plain := httptest.NewRequest("GET", "http://example.com/", nil)
+    if s := manager.SessionStart(rec, plain); s != nil || responseCookie(rec, "sid") != nil || len(p.sessions) != 0 {
+        t.Fatalf("plain http SessionStart = %v, cookie %v, want no session", s, responseCookie(rec, "sid"))
+    }
+    if _, err := manager.ApiSessionStart(plain); err != ErrTLSRequired {
+        t.Fatalf("plain http ApiSessionStart = %v, want ErrTLSRequired", err)
+    }
+    if _, err := manager.Login(httptest.NewRecorder(), plain, "alice"); err != ErrTLSRequired {
+        t.Fatalf("plain http Login = %v, want ErrTLSRequired", err)
+    }
+
+    forwarded := httptest.NewRequest("GET", "http://example.com/", nil)
+    forwarded.Header.Set("X-Forwarded-Proto", "https")
+    for _, r := range []*http.Request{httptest.NewRequest("GET", "https://example.com/", nil), forwarded} {
+        rec := httptest.NewRecorder()
+        if s := manager.SessionStart(rec, r); s == nil || responseCookie(rec, "sid") == nil {
+            t.Errorf("%s %v: no session over https", r.URL, r.Header)
+        }
+    }
+}
+
+func TestRequireTLSHandler(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetRequireTLS(true)
+    called := false
+    h := manager.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/", nil))
+    if rec.Code != http.StatusForbidden || called || responseCookie(rec, "sid") != nil {
+        t.Fatalf("plain http answered %d, next called %v, want 403 without a session", rec.Code, called)
+    }
+
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest("GET", "https://example.com/", nil))
+    if rec.Code != http.StatusOK || !called {
+        t.Fatalf("https answered %d, next called %v, want the session handed on", rec.Code, called)
+    }
+}
@@ -0,0 +1,29 @@
+package session
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+)
+
+// length of a correlation id in hex characters
+const correlationIDLen = 12
+
+// CorrelationID return a short id, stable for the lifetime of s, to tie log
+// lines to the session without logging the sid itself
+func (manager *Manager) CorrelationID(s Session) string {
+    sum := sha256.Sum256([]byte("correlation:" + s.SessionID()))
+    return hex.EncodeToString(sum[:])[:correlationIDLen]
+}
+
+// WithCorrelationID return a copy of ctx carrying the correlation id of s,
+// for middleware feeding structured logging
+func (manager *Manager) WithCorrelationID(ctx context.Context, s Session) context.Context {
+    return context.WithValue(ctx, correlationContextKey, manager.CorrelationID(s))
+}
+
+// CorrelationIDFromContext return the correlation id stored by WithCorrelationID
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+    id, ok := ctx.Value(correlationContextKey).(string)
+    return id, ok
+}
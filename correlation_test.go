@@ -0,0 +1,30 @@
+package session
+
+import (
+    "context"
+    "strings"
+    "testing"
+)
+
+func TestCorrelationID(t *testing.T) {
+    manager, _ := newTestManager(t)
+    a, b := manager.ApiSessionCreate(), manager.ApiSessionCreate()
+    id := manager.CorrelationID(a)
+    if len(id) != correlationIDLen || id != manager.CorrelationID(a) {
+        t.Fatalf("CorrelationID = %q, want a stable id of %d characters", id, correlationIDLen)
+    }
+    if id == manager.CorrelationID(b) {
+        t.Fatal("two sessions share a correlation id")
+    }
+    if strings.Contains(a.SessionID(), id) {
+        t.Fatal("correlation id is part of the sid")
+    }
+
+    ctx := manager.WithCorrelationID(context.Background(), a)
+    if got, ok := CorrelationIDFromContext(ctx); !ok || got != id {
+        t.Fatalf("CorrelationIDFromContext = %q, %v, want %q", got, ok, id)
+    }
+    if _, ok := CorrelationIDFromContext(context.Background()); ok {
+        t.Fatal("plain context reported a correlation id")
+    }
+}
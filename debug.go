@@ -0,0 +1,62 @@
+package session
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+)
+
+// reserved keys holding secrets, never shown in debug dumps
+var secretKeys = map[interface{}]bool{keyNonce: true}
+
+// shown instead of redacted values
+const redacted = "[redacted]"
+
+// DebugCodec encode session values as indented JSON for humans: one entry
+// per key, sorted, with the Go types of key and value. secret reserved keys
+// and the keys in Redact are masked. the output can't be decoded, use it
+// for dumps only, never as the storage codec
+type DebugCodec struct {
+    Redact []interface{}
+}
+
+type debugEntry struct {
+    Key       string      `json:"key"`
+    KeyType   string      `json:"key_type"`
+    ValueType string      `json:"type"`
+    Value     interface{} `json:"value"`
+}
+
+func (c DebugCodec) Encode(values map[interface{}]interface{}) ([]byte, error) {
+    redact := make(map[interface{}]bool, len(c.Redact))
+    for _, k := range c.Redact {
+        redact[k] = true
+    }
+    entries := make([]debugEntry, 0, len(values))
+    for k, v := range values {
+        e := debugEntry{Key: fmt.Sprint(k), KeyType: fmt.Sprintf("%T", k), ValueType: fmt.Sprintf("%T", v), Value: v}
+        if secretKeys[k] || redact[k] {
+            e.Value = redacted
+        } else if _, err := json.Marshal(v); err != nil {
+            // not representable in JSON, fall back to the Go syntax
+            e.Value = fmt.Sprintf("%#v", v)
+        }
+        entries = append(entries, e)
+    }
+    sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+    return json.MarshalIndent(entries, "", "  ")
+}
+
+// DebugDump return the values of s encoded with DebugCodec, for incident
+// investigation. s must implement Snapshotter
+func (manager *Manager) DebugDump(s Session) (string, error) {
+    snap, ok := unwrapSession(s).(Snapshotter)
+    if !ok {
+        return "", errNoSnapshot
+    }
+    data, err := DebugCodec{}.Encode(snap.Snapshot())
+    if err != nil {
+        return "", err
+    }
+    return string(data), nil
+}
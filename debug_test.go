@@ -0,0 +1,63 @@
+package session
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+func TestDebugCodec(t *testing.T) {
+    values := map[interface{}]interface{}{
+        "user":     "alice",
+        "password": "hunter2",
+        1:          int64(5),
+        "callback": func() {},
+    }
+    data, err := DebugCodec{Redact: []interface{}{"password"}}.Encode(values)
+    if err != nil {
+        t.Fatalf("Encode: %v", err)
+    }
+    var entries []debugEntry
+    if err := json.Unmarshal(data, &entries); err != nil {
+        t.Fatalf("dump isn't JSON: %v\n%s", err, data)
+    }
+    got := make(map[string]debugEntry)
+    var keys []string
+    for _, e := range entries {
+        got[e.Key] = e
+        keys = append(keys, e.Key)
+    }
+    if strings.Join(keys, ",") != "1,callback,password,user" {
+        t.Fatalf("keys %v, want them sorted", keys)
+    }
+    if e := got["1"]; e.KeyType != "int" || e.ValueType != "int64" {
+        t.Fatalf("entry %+v, want the Go types", e)
+    }
+    if got["password"].Value != redacted || got["user"].Value != "alice" {
+        t.Fatalf("password %v, user %v, want only the password redacted", got["password"].Value, got["user"].Value)
+    }
+    if v, _ := got["callback"].Value.(string); !strings.HasPrefix(v, "(func())") {
+        t.Fatalf("func value shown as %v, want the Go syntax", got["callback"].Value)
+    }
+}
+
+func TestDebugDump(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetRollingNonce(true)
+    s, _ := startNew(t, manager)
+    nonce, _ := s.Get(keyNonce).(string)
+    if nonce == "" {
+        t.Fatal("no nonce stored with rolling nonces on")
+    }
+    dump, err := manager.DebugDump(s)
+    if err != nil {
+        t.Fatalf("DebugDump: %v", err)
+    }
+    if strings.Contains(dump, nonce) || !strings.Contains(dump, redacted) {
+        t.Fatalf("dump shows the nonce:\n%s", dump)
+    }
+
+    if _, err := manager.DebugDump(struct{ Session }{s}); err == nil {
+        t.Fatal("DebugDump of a session without Snapshot succeeded")
+    }
+}
@@ -0,0 +1,30 @@
+package session
+
+// reserved key flagging transient sessions served while the provider fails
+const keyDegraded = "_session_degraded"
+
+// set whether SessionStart serves a transient session when the provider
+// fails, instead of returning nil. such sessions are not stored and
+// IsDegraded reports true for them
+func (manager *Manager) SetFailOpen(failOpen bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.failOpen = failOpen
+}
+
+// IsDegraded report whether s is a transient session served in fail-open mode,
+// handlers may want to skip writes for it
+func (manager *Manager) IsDegraded(s Session) bool {
+    degraded, _ := s.Get(keyDegraded).(bool)
+    return degraded
+}
+
+// transient session for sid when failing open, nil otherwise
+func (manager *Manager) degradedSession(sid string) Session {
+    if !manager.failOpen {
+        return nil
+    }
+    session := newTransientSession(sid)
+    session.Set(keyDegraded, true)
+    return session
+}
@@ -0,0 +1,33 @@
+package session
+
+import (
+    "errors"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestFailOpen(t *testing.T) {
+    manager, p := newTestManager(t)
+    s, c := startNew(t, manager)
+    if manager.IsDegraded(s) {
+        t.Fatal("stored session reported degraded")
+    }
+    p.readErr = errors.New("store down")
+
+    if got := manager.SessionStart(httptest.NewRecorder(), requestWith(c)); got != nil {
+        t.Fatalf("SessionStart with a failing provider = %v, want nil", got)
+    }
+
+    manager.SetFailOpen(true)
+    got := manager.SessionStart(httptest.NewRecorder(), requestWith(c))
+    if got == nil || !manager.IsDegraded(got) {
+        t.Fatalf("SessionStart failing open = %v, want a degraded session", got)
+    }
+    if got.SessionID() != s.SessionID() {
+        t.Fatalf("degraded session has sid %q, want the one of the request", got.SessionID())
+    }
+    got.Set("cart", 1)
+    if p.stored(s.SessionID()).Get("cart") != nil {
+        t.Fatal("write to a degraded session reached the store")
+    }
+}
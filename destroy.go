@@ -0,0 +1,54 @@
+package session
+
+// ExpiryNotifier is implemented by providers which report the sessions their
+// SessionGC removes, together with the values they held
+type ExpiryNotifier interface {
+    OnExpire(notify func(sid string, values map[interface{}]interface{}))
+}
+
+// set a callback invoked with the final values of a session right before
+// SessionEnd, ApiSessionEnd or the absolute timeout destroys it, and after
+// the provider garbage collected it when the provider is an ExpiryNotifier.
+// for collected sessions sid is the store key, the hash of the sid with
+// SetHashStoreKeys. values is nil for sessions which aren't Snapshotters.
+// except for collected sessions f is called with the lock held and must not
+// call back into the manager
+func (manager *Manager) SetOnDestroy(f func(sid string, values map[interface{}]interface{})) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.onDestroy = f
+}
+
+// run the destroy callback for s, caller must hold the lock
+func (manager *Manager) notifyDestroy(s Session) {
+    if manager.onDestroy == nil {
+        return
+    }
+    var values map[interface{}]interface{}
+    if snap, ok := unwrapSession(s).(Snapshotter); ok {
+        values = snap.Snapshot()
+    }
+    manager.onDestroy(s.SessionID(), values)
+}
+
+// forward sessions the provider expires to the destroy callbacks of the
+// managers using it, see watch
+func (manager *Manager) watchExpiry() {
+    notifier, ok := manager.provider.(ExpiryNotifier)
+    if !ok {
+        return
+    }
+    p := manager.provider
+    manager.watch("expiry", func() {
+        notifier.OnExpire(func(sid string, values map[interface{}]interface{}) {
+            for _, m := range watchersOf(p) {
+                m.lock.Lock()
+                f := m.onDestroy
+                m.lock.Unlock()
+                if f != nil {
+                    f(sid, values)
+                }
+            }
+        })
+    })
+}
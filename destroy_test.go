@@ -0,0 +1,63 @@
+package session
+
+import (
+    "net/http/httptest"
+    "testing"
+)
+
+// sid and values of every destroy callback
+type destroyed struct {
+    sids   []string
+    values []map[interface{}]interface{}
+}
+
+func (d *destroyed) record(sid string, values map[interface{}]interface{}) {
+    d.sids = append(d.sids, sid)
+    d.values = append(d.values, values)
+}
+
+func TestOnDestroy(t *testing.T) {
+    manager, _ := newTestManager(t)
+    var got destroyed
+    manager.SetOnDestroy(got.record)
+
+    s, _ := startNew(t, manager)
+    s.Set("upload", "/tmp/x")
+    manager.SessionEnd(httptest.NewRecorder(), s)
+    api := manager.ApiSessionCreate()
+    manager.ApiSessionEnd(api)
+
+    if len(got.sids) != 2 || got.sids[0] != s.SessionID() || got.sids[1] != api.SessionID() {
+        t.Fatalf("callback got sids %v, want the ended sessions", got.sids)
+    }
+    if got.values[0]["upload"] != "/tmp/x" {
+        t.Fatalf("callback got values %v, want the final ones", got.values[0])
+    }
+}
+
+func TestOnDestroyExpired(t *testing.T) {
+    p := newReportingProvider()
+    first, second := newManagerOn(t, p), newManagerOn(t, p)
+    var a, b destroyed
+    first.SetOnDestroy(a.record)
+    second.SetOnDestroy(b.record)
+    for i := 0; i < 3; i++ {
+        newManagerOn(t, p).Close()
+    }
+    if len(p.expires) != 1 {
+        t.Fatalf("%d expiry callbacks registered, want one per provider", len(p.expires))
+    }
+
+    s := first.ApiSessionCreate()
+    s.Set("upload", "/tmp/x")
+    p.collect(s.SessionID())
+    if len(a.sids) != 1 || a.values[0]["upload"] != "/tmp/x" || len(b.sids) != 1 {
+        t.Fatalf("callbacks got %v and %v, want the expired session in both", a.sids, b.sids)
+    }
+
+    second.Close()
+    p.collect(first.ApiSessionCreate().SessionID())
+    if len(a.sids) != 2 || len(b.sids) != 1 {
+        t.Fatalf("after Close callbacks got %v and %v, want only the open manager told", a.sids, b.sids)
+    }
+}
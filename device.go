@@ -0,0 +1,43 @@
+package session
+
+import "net/http"
+
+// reserved keys holding the DeviceInfo of a session
+const (
+    keyDeviceUA       = "_session_device_ua"
+    keyDeviceLocation = "_session_device_location"
+)
+
+// DeviceInfo describe where a session was created, for "Chrome on Windows
+// from San Francisco" style labels
+type DeviceInfo struct {
+    UserAgent string // summary of the user agent
+    Location  string // where the request came from, e.g. resolved from the ip
+}
+
+// set a func resolving the device of requests which create a session, the
+// result is stored in the session and reported by Inspect. the resolver is
+// called with the lock held and must not call back into the manager
+func (manager *Manager) SetDeviceResolver(f func(r *http.Request) DeviceInfo) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.deviceResolver = f
+}
+
+// store the device of r in session, caller must hold the lock
+func (manager *Manager) recordDevice(session Session, r *http.Request) {
+    if manager.deviceResolver == nil {
+        return
+    }
+    info := manager.deviceResolver(r)
+    session.Set(keyDeviceUA, info.UserAgent)
+    session.Set(keyDeviceLocation, info.Location)
+}
+
+// device stored in s, zero if there is none
+func deviceOf(s Session) DeviceInfo {
+    var info DeviceInfo
+    info.UserAgent, _ = s.Get(keyDeviceUA).(string)
+    info.Location, _ = s.Get(keyDeviceLocation).(string)
+    return info
+}
@@ -0,0 +1,37 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestDeviceResolver(t *testing.T) {
+    manager, _ := newTestManager(t)
+    calls := 0
+    manager.SetDeviceResolver(func(r *http.Request) DeviceInfo {
+        calls++
+        return DeviceInfo{UserAgent: r.UserAgent(), Location: "San Francisco"}
+    })
+
+    r := requestWith()
+    r.Header.Set("User-Agent", "Chrome on Windows")
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, r)
+    want := DeviceInfo{UserAgent: "Chrome on Windows", Location: "San Francisco"}
+    meta := manager.Inspect(s)
+    if meta.Device != want {
+        t.Fatalf("device = %+v, want %+v", meta.Device, want)
+    }
+    if meta.KeyCount != 0 {
+        t.Fatalf("KeyCount = %d, device keys should be reserved", meta.KeyCount)
+    }
+
+    // resolved on creation only
+    later := requestWith(responseCookie(rec, "sid"))
+    later.Header.Set("User-Agent", "Firefox on Linux")
+    s = manager.SessionStart(httptest.NewRecorder(), later)
+    if got := manager.Inspect(s).Device; got != want || calls != 1 {
+        t.Fatalf("device after a later request = %+v with %d resolver calls, want it unchanged", got, calls)
+    }
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "errors"
+    "io"
+)
+
+// Encrypter protect encoded session values at rest. sid is the key the
+// provider stores the session under, so encrypters may bind blobs to it
+type Encrypter interface {
+    Encrypt(sid string, plain []byte) ([]byte, error)
+    Decrypt(sid string, blob []byte) ([]byte, error)
+}
+
+var ErrDecrypt = errors.New("session: can't decrypt session data")
+
+// PerSessionEncrypter encrypt every session with AES-256-GCM under its own
+// key, derived with HKDF-SHA256 from a master key and the sid. a leaked
+// derived key exposes only the one session. blobs are nonce followed by ciphertext
+type PerSessionEncrypter struct {
+    master []byte
+}
+
+// NewPerSessionEncrypter return an encrypter deriving keys from master,
+// which must be at least 32 random bytes
+func NewPerSessionEncrypter(master []byte) (*PerSessionEncrypter, error) {
+    if len(master) < 32 {
+        return nil, errors.New("session: master key must be at least 32 bytes")
+    }
+    return &PerSessionEncrypter{master: append([]byte(nil), master...)}, nil
+}
+
+// HKDF (RFC 5869) extract and expand, one output block is the 32 bytes AES-256 needs
+func (e *PerSessionEncrypter) key(sid string) []byte {
+    extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+    extract.Write(e.master)
+    prk := extract.Sum(nil)
+
+    expand := hmac.New(sha256.New, prk)
+    expand.Write([]byte("session:" + sid))
+    expand.Write([]byte{1})
+    return expand.Sum(nil)
+}
+
+func (e *PerSessionEncrypter) aead(sid string) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(e.key(sid))
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+func (e *PerSessionEncrypter) Encrypt(sid string, plain []byte) ([]byte, error) {
+    aead, err := e.aead(sid)
+    if err != nil {
+        return nil, err
+    }
+    nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return nil, err
+    }
+    return aead.Seal(nonce, nonce, plain, []byte(sid)), nil
+}
+
+func (e *PerSessionEncrypter) Decrypt(sid string, blob []byte) ([]byte, error) {
+    aead, err := e.aead(sid)
+    if err != nil {
+        return nil, err
+    }
+    if len(blob) < aead.NonceSize() {
+        return nil, ErrDecrypt
+    }
+    nonce, sealed := blob[:aead.NonceSize()], blob[aead.NonceSize():]
+    plain, err := aead.Open(nil, nonce, sealed, []byte(sid))
+    if err != nil {
+        return nil, ErrDecrypt
+    }
+    return plain, nil
+}
@@ -0,0 +1,46 @@
+package session
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestPerSessionEncrypter(t *testing.T) {
+    e, err := NewPerSessionEncrypter(bytes.Repeat([]byte{7}, 32))
+    if err != nil {
+        t.Fatalf("NewPerSessionEncrypter: %v", err)
+    }
+    plain := []byte("user=alice")
+    blob, err := e.Encrypt("sid1", plain)
+    if err != nil {
+        t.Fatalf("Encrypt: %v", err)
+    }
+    if bytes.Contains(blob, plain) {
+        t.Fatal("blob contains the plain text")
+    }
+    if again, _ := e.Encrypt("sid1", plain); bytes.Equal(again, blob) {
+        t.Fatal("two encryptions gave the same blob, nonce reused")
+    }
+    got, err := e.Decrypt("sid1", blob)
+    if err != nil || !bytes.Equal(got, plain) {
+        t.Fatalf("Decrypt = %q, %v, want %q", got, err, plain)
+    }
+
+    // the blob is bound to its sid and can't be altered
+    if _, err := e.Decrypt("sid2", blob); err != ErrDecrypt {
+        t.Fatalf("Decrypt under another sid = %v, want ErrDecrypt", err)
+    }
+    blob[len(blob)-1] ^= 1
+    if _, err := e.Decrypt("sid1", blob); err != ErrDecrypt {
+        t.Fatalf("Decrypt of a tampered blob = %v, want ErrDecrypt", err)
+    }
+    if _, err := e.Decrypt("sid1", blob[:4]); err != ErrDecrypt {
+        t.Fatalf("Decrypt of a short blob = %v, want ErrDecrypt", err)
+    }
+}
+
+func TestPerSessionEncrypterShortKey(t *testing.T) {
+    if _, err := NewPerSessionEncrypter(make([]byte, 16)); err == nil {
+        t.Fatal("NewPerSessionEncrypter accepted a 16 byte master key")
+    }
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+    "reflect"
+    "sync"
+    "sync/atomic"
+    log "github.com/cihub/seelog"
+)
+
+// GCReporter is implemented by providers which report how many sessions each
+// of their garbage collections removed, also for expiry they do on their own
+type GCReporter interface {
+    OnGC(report func(collected int))
+}
+
+// managers using each provider. callbacks are registered with a provider
+// once, by the first manager, and fan out to the managers not yet closed
+var watchers = struct {
+    sync.Mutex
+    byProvider map[Provider]*providerWatch
+}{byProvider: make(map[Provider]*providerWatch)}
+
+type providerWatch struct {
+    managers  map[*Manager]bool
+    installed map[string]bool // kinds of callbacks registered with the provider
+}
+
+// add manager to the watchers of its provider and run install when no
+// manager registered callbacks of kind yet
+func (manager *Manager) watch(kind string, install func()) {
+    p := manager.provider
+    if !reflect.TypeOf(p).Comparable() {
+        log.Warnf("session: provider %T can't be watched, use a pointer", p)
+        return
+    }
+    watchers.Lock()
+    w := watchers.byProvider[p]
+    if w == nil {
+        w = &providerWatch{managers: make(map[*Manager]bool), installed: make(map[string]bool)}
+        watchers.byProvider[p] = w
+    }
+    w.managers[manager] = true
+    first := !w.installed[kind]
+    w.installed[kind] = true
+    watchers.Unlock()
+    if first {
+        install()
+    }
+}
+
+// managers watching p
+func watchersOf(p Provider) []*Manager {
+    watchers.Lock()
+    defer watchers.Unlock()
+    w := watchers.byProvider[p]
+    if w == nil {
+        return nil
+    }
+    managers := make([]*Manager, 0, len(w.managers))
+    for m := range w.managers {
+        managers = append(managers, m)
+    }
+    return managers
+}
+
+// Close stop the manager from receiving the callbacks of its provider, so
+// it can be garbage collected. call it when discarding a manager while the
+// provider lives on
+func (manager *Manager) Close() {
+    if !reflect.TypeOf(manager.provider).Comparable() {
+        return
+    }
+    watchers.Lock()
+    defer watchers.Unlock()
+    if w := watchers.byProvider[manager.provider]; w != nil {
+        delete(w.managers, manager)
+    }
+}
+
+// count sessions a GCReporter provider removes
+func (manager *Manager) watchGC() {
+    reporter, ok := manager.provider.(GCReporter)
+    if !ok {
+        return
+    }
+    p := manager.provider
+    manager.watch("gc", func() {
+        reporter.OnGC(func(collected int) {
+            for _, m := range watchersOf(p) {
+                atomic.AddUint64(&m.gcCollected, uint64(collected))
+            }
+        })
+    })
+}
+
+// GCCollected return the number of sessions garbage collected by the provider
+// since the manager was created, 0 unless the provider is a GCReporter
+func (manager *Manager) GCCollected() uint64 {
+    return atomic.LoadUint64(&manager.gcCollected)
+}
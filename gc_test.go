@@ -0,0 +1,87 @@
+package session
+
+import (
+    "sync"
+    "testing"
+)
+
+// fakeProvider keeping the callbacks of OnGC and OnExpire, run collects
+type reportingProvider struct {
+    *fakeProvider
+    lock    sync.Mutex
+    reports []func(collected int)
+    expires []func(sid string, values map[interface{}]interface{})
+}
+
+func newReportingProvider() *reportingProvider {
+    return &reportingProvider{fakeProvider: newFakeProvider()}
+}
+
+func (p *reportingProvider) OnGC(report func(collected int)) {
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    p.reports = append(p.reports, report)
+}
+
+func (p *reportingProvider) OnExpire(notify func(sid string, values map[interface{}]interface{})) {
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    p.expires = append(p.expires, notify)
+}
+
+// expire the sessions sids and report them to the callbacks
+func (p *reportingProvider) collect(sids ...string) {
+    p.lock.Lock()
+    reports, expires := p.reports, p.expires
+    p.lock.Unlock()
+    for _, sid := range sids {
+        var values map[interface{}]interface{}
+        if st := p.stored(sid); st != nil {
+            values = st.Snapshot()
+        }
+        p.SessionDestroy(sid)
+        for _, notify := range expires {
+            notify(sid, values)
+        }
+    }
+    for _, report := range reports {
+        report(len(sids))
+    }
+}
+
+func newManagerOn(t *testing.T, p Provider) *Manager {
+    t.Helper()
+    manager, err := NewManager("test", "sid", 3600, WithFallbackProvider(p))
+    if err != nil {
+        t.Fatalf("NewManager: %v", err)
+    }
+    t.Cleanup(manager.Close)
+    return manager
+}
+
+func TestGCCollected(t *testing.T) {
+    p := newReportingProvider()
+    first, second := newManagerOn(t, p), newManagerOn(t, p)
+    for i := 0; i < 5; i++ {
+        newManagerOn(t, p).Close()
+    }
+    if len(p.reports) != 1 {
+        t.Fatalf("%d GC callbacks registered, want one per provider", len(p.reports))
+    }
+
+    p.collect("a", "b", "c")
+    if first.GCCollected() != 3 || second.GCCollected() != 3 {
+        t.Fatalf("GCCollected = %d and %d, want 3 for both managers", first.GCCollected(), second.GCCollected())
+    }
+
+    second.Close()
+    p.collect("d")
+    if first.GCCollected() != 4 || second.GCCollected() != 3 {
+        t.Fatalf("after Close GCCollected = %d and %d, want 4 and 3", first.GCCollected(), second.GCCollected())
+    }
+
+    plain, _ := newTestManager(t)
+    if plain.GCCollected() != 0 {
+        t.Fatal("GCCollected without a GCReporter is not 0")
+    }
+}
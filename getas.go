@@ -0,0 +1,10 @@
+//go:build go1.18
+
+package session
+
+// GetAs return the value of key in s as a T, with false when the key is
+// absent or holds a value of another type
+func GetAs[T any](s Session, key interface{}) (T, bool) {
+    v, ok := s.Get(key).(T)
+    return v, ok
+}
@@ -0,0 +1,19 @@
+//go:build go1.18
+
+package session
+
+import "testing"
+
+func TestGetAs(t *testing.T) {
+    s := newTransientSession("t")
+    s.Set("n", 3)
+    if n, ok := GetAs[int](s, "n"); !ok || n != 3 {
+        t.Fatalf("GetAs[int] = %v, %v, want 3, true", n, ok)
+    }
+    if v, ok := GetAs[string](s, "n"); ok || v != "" {
+        t.Fatalf("GetAs[string] of an int = %q, %v, want the zero value and false", v, ok)
+    }
+    if v, ok := GetAs[int](s, "missing"); ok || v != 0 {
+        t.Fatalf("GetAs of a missing key = %v, %v, want 0, false", v, ok)
+    }
+}
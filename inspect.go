@@ -0,0 +1,64 @@
+package session
+
+import (
+    "time"
+)
+
+// TTLer is implemented by providers which track expiry themselves
+type TTLer interface {
+    TTL(sid string) (time.Duration, error)
+}
+
+// SessionMeta describe a session for admin and debug code
+type SessionMeta struct {
+    ID             string
+    CreatedAt      time.Time
+    LastAccessedAt time.Time
+    ExpiresAt      time.Time
+    UserID         string
+    Authenticated  bool
+    Device         DeviceInfo // as resolved on creation, see SetDeviceResolver
+    KeyCount       int        // number of non reserved keys, -1 if the session can't list them
+}
+
+// Inspect collect the metadata of s from the reserved keys. ExpiresAt comes
+// from the provider when it implements TTLer, otherwise from the last access
+// plus the manager lifetime
+func (manager *Manager) Inspect(s Session) SessionMeta {
+    meta := SessionMeta{ID: s.SessionID(), KeyCount: -1}
+    if created, ok := s.Get(keyCreatedAt).(int64); ok {
+        meta.CreatedAt = time.Unix(created, 0)
+    }
+    if accessed, ok := s.Get(keyAccessedAt).(int64); ok {
+        meta.LastAccessedAt = time.Unix(accessed, 0)
+    }
+    if uid, ok := s.Get(keyUserID).(string); ok {
+        meta.UserID = uid
+        meta.Authenticated = uid != ""
+    }
+    meta.Device = deviceOf(s)
+
+    if ttler, ok := manager.provider.(TTLer); ok {
+        if ttl, err := ttler.TTL(manager.storeKey(meta.ID)); err == nil {
+            meta.ExpiresAt = manager.now().Add(ttl)
+        }
+    } else if !meta.LastAccessedAt.IsZero() {
+        meta.ExpiresAt = meta.LastAccessedAt.Add(time.Duration(manager.maxlifetime) * time.Second)
+    }
+
+    if snap, ok := unwrapSession(s).(Snapshotter); ok {
+        meta.KeyCount = countKeys(snap.Snapshot())
+    }
+    return meta
+}
+
+// number of non reserved keys in values
+func countKeys(values map[interface{}]interface{}) int {
+    n := 0
+    for k := range values {
+        if !isReserved(k) {
+            n++
+        }
+    }
+    return n
+}
@@ -0,0 +1,68 @@
+package session
+
+import (
+    "testing"
+    "time"
+)
+
+// fakeProvider reporting a fixed ttl for every session, as a TTLer
+type ttlProvider struct {
+    *fakeProvider
+    ttl   time.Duration
+    asked []string
+}
+
+func (p *ttlProvider) TTL(sid string) (time.Duration, error) {
+    p.asked = append(p.asked, sid)
+    return p.ttl, nil
+}
+
+func TestInspect(t *testing.T) {
+    manager, _ := newTestManager(t)
+    now := time.Unix(1700000000, 0)
+    manager.SetClock(func() time.Time { return now })
+
+    s, _ := startNew(t, manager)
+    s.Set("cart", 3)
+    s.Set(keyUserID, "alice")
+    meta := manager.Inspect(s)
+    if meta.ID != s.SessionID() || !meta.CreatedAt.Equal(now) || !meta.LastAccessedAt.Equal(now) {
+        t.Fatalf("meta = %+v, want created and accessed now", meta)
+    }
+    if meta.UserID != "alice" || !meta.Authenticated {
+        t.Fatalf("meta user = %q, %v, want alice authenticated", meta.UserID, meta.Authenticated)
+    }
+    if want := now.Add(time.Hour); !meta.ExpiresAt.Equal(want) {
+        t.Fatalf("ExpiresAt = %v, want last access plus the lifetime %v", meta.ExpiresAt, want)
+    }
+    if meta.KeyCount != 1 {
+        t.Fatalf("KeyCount = %d, want 1, reserved keys not counted", meta.KeyCount)
+    }
+
+    // the embedded interface hides Snapshot
+    bare := struct{ Session }{newTransientSession("t")}
+    if meta := manager.Inspect(bare); meta.KeyCount != -1 || meta.Authenticated {
+        t.Fatalf("meta of a bare session = %+v, want KeyCount -1 and anonymous", meta)
+    }
+}
+
+func TestInspectTTLer(t *testing.T) {
+    p := &ttlProvider{fakeProvider: newFakeProvider(), ttl: 10 * time.Minute}
+    manager, err := NewManager("test", "sid", 3600, WithFallbackProvider(p))
+    if err != nil {
+        t.Fatalf("NewManager: %v", err)
+    }
+    defer manager.Close()
+    now := time.Unix(1700000000, 0)
+    manager.SetClock(func() time.Time { return now })
+    manager.SetHashStoreKeys(true)
+
+    s, _ := startNew(t, manager)
+    meta := manager.Inspect(s)
+    if want := now.Add(10 * time.Minute); !meta.ExpiresAt.Equal(want) {
+        t.Fatalf("ExpiresAt = %v, want now plus the provider ttl %v", meta.ExpiresAt, want)
+    }
+    if len(p.asked) != 1 || p.asked[0] != manager.storeKey(s.SessionID()) {
+        t.Fatalf("TTL asked for %v, want the store key", p.asked)
+    }
+}
@@ -0,0 +1,43 @@
+package session
+
+import (
+    "net"
+    "net/http"
+)
+
+// reserved key holding the ip a session was last started from
+const keyLastIP = "_session_last_ip"
+
+// set a callback SessionStart invokes when a session comes from another ip
+// than the one it was last started from, e.g. for risk scoring. the session
+// stays valid. the ip is taken from r.RemoteAddr, proxies have to rewrite it.
+// f is called with the lock held and must not call back into the manager
+func (manager *Manager) SetOnIPChange(f func(s Session, oldIP, newIP string)) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.onIPChange = f
+}
+
+// host part of r.RemoteAddr
+func clientIP(r *http.Request) string {
+    if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+        return host
+    }
+    return r.RemoteAddr
+}
+
+// remember the ip of r in session and report a change, caller must hold the lock
+func (manager *Manager) checkIP(session Session, r *http.Request) {
+    if manager.onIPChange == nil {
+        return
+    }
+    ip := clientIP(r)
+    old, _ := session.Get(keyLastIP).(string)
+    if old == ip {
+        return
+    }
+    session.Set(keyLastIP, ip)
+    if old != "" {
+        manager.onIPChange(session, old, ip)
+    }
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestOnIPChange(t *testing.T) {
+    manager, _ := newTestManager(t)
+    type change struct{ sid, old, new string }
+    var changes []change
+    manager.SetOnIPChange(func(s Session, oldIP, newIP string) {
+        changes = append(changes, change{s.SessionID(), oldIP, newIP})
+    })
+    from := func(ip string, cookies ...*http.Cookie) *http.Request {
+        r := requestWith(cookies...)
+        r.RemoteAddr = ip + ":1234"
+        return r
+    }
+
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, from("10.0.0.1"))
+    c := responseCookie(rec, "sid")
+    manager.SessionStart(httptest.NewRecorder(), from("10.0.0.1", c))
+    if len(changes) != 0 {
+        t.Fatalf("changes %v for requests from one ip", changes)
+    }
+
+    got := manager.SessionStart(httptest.NewRecorder(), from("10.0.0.2", c))
+    if got.SessionID() != s.SessionID() {
+        t.Fatal("session not kept after an ip change")
+    }
+    want := change{s.SessionID(), "10.0.0.1", "10.0.0.2"}
+    if len(changes) != 1 || changes[0] != want {
+        t.Fatalf("changes = %v, want %v", changes, want)
+    }
+    manager.SessionStart(httptest.NewRecorder(), from("10.0.0.2", c))
+    if len(changes) != 1 {
+        t.Fatalf("changes = %v, want none for the same new ip", changes)
+    }
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+)
+
+// KeyCoercion tell JSONCodec what to do with keys which aren't strings
+type KeyCoercion int
+
+const (
+    StringifyKeys    KeyCoercion = iota // store fmt.Sprint(key), the key decodes as that string
+    ErrorOnNonString                    // fail the encoding
+)
+
+// JSONCodec encode session values as a JSON object. JSON has no types beyond
+// its own: integral numbers decode as int64, other numbers as float64,
+// objects as map[string]interface{}. numeric reserved keys are int64 for that reason
+type JSONCodec struct {
+    Keys KeyCoercion
+}
+
+func (c JSONCodec) Encode(values map[interface{}]interface{}) ([]byte, error) {
+    m := make(map[string]interface{}, len(values))
+    for k, v := range values {
+        key, ok := k.(string)
+        if !ok {
+            if c.Keys == ErrorOnNonString {
+                return nil, fmt.Errorf("session: json codec can't encode non string key %v (%T)", k, k)
+            }
+            key = fmt.Sprint(k)
+        }
+        if _, dup := m[key]; dup {
+            return nil, fmt.Errorf("session: json codec key %q is not unique", key)
+        }
+        m[key] = v
+    }
+    return json.Marshal(m)
+}
+
+func (c JSONCodec) Decode(data []byte) (map[interface{}]interface{}, error) {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+    var m map[string]interface{}
+    if err := dec.Decode(&m); err != nil {
+        return nil, err
+    }
+    values := make(map[interface{}]interface{}, len(m))
+    for k, v := range m {
+        if n, ok := v.(json.Number); ok {
+            if i, err := n.Int64(); err == nil {
+                v = i
+            } else if f, err := n.Float64(); err == nil {
+                v = f
+            }
+        }
+        values[k] = v
+    }
+    return values, nil
+}
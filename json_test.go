@@ -0,0 +1,46 @@
+package session
+
+import "testing"
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+    values := map[interface{}]interface{}{
+        "name":       "alice",
+        keyCreatedAt: int64(1700000000),
+        "ratio":      0.5,
+        "tags":       []interface{}{"a"},
+        "ok":         true,
+    }
+    data, err := JSONCodec{}.Encode(values)
+    if err != nil {
+        t.Fatalf("Encode: %v", err)
+    }
+    got, err := JSONCodec{}.Decode(data)
+    if err != nil {
+        t.Fatalf("Decode: %v", err)
+    }
+    if got["name"] != "alice" || got[keyCreatedAt] != int64(1700000000) || got["ratio"] != 0.5 || got["ok"] != true {
+        t.Fatalf("decoded %v, want integral numbers as int64 and the rest as is", got)
+    }
+    if tags, _ := got["tags"].([]interface{}); len(tags) != 1 || tags[0] != "a" {
+        t.Fatalf("decoded tags %v", got["tags"])
+    }
+}
+
+func TestJSONCodecKeys(t *testing.T) {
+    values := map[interface{}]interface{}{42: "answer"}
+    data, err := JSONCodec{Keys: StringifyKeys}.Encode(values)
+    if err != nil {
+        t.Fatalf("Encode with StringifyKeys: %v", err)
+    }
+    if got, _ := (JSONCodec{}).Decode(data); got["42"] != "answer" {
+        t.Fatalf("stringified key decoded as %v, want \"42\"", got)
+    }
+
+    if _, err := (JSONCodec{Keys: ErrorOnNonString}).Encode(values); err == nil {
+        t.Fatal("ErrorOnNonString encoded a non string key")
+    }
+    clash := map[interface{}]interface{}{42: "int", "42": "string"}
+    if _, err := (JSONCodec{}).Encode(clash); err == nil {
+        t.Fatal("keys clashing after stringifying were encoded")
+    }
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+    "math"
+    "sync"
+    "time"
+)
+
+// buckets per doubling of duration, each bucket is ~19% wide
+const bucketsPerOctave = 4
+
+// enough buckets to cover up to 2^40 ns (about 18 minutes)
+const latencyBuckets = 40 * bucketsPerOctave
+
+// LatencyStat summarize observed latencies of one provider operation
+type LatencyStat struct {
+    Count uint64
+    P50   time.Duration
+    P95   time.Duration
+    P99   time.Duration
+}
+
+// log scaled histogram of durations
+type histogram struct {
+    counts [latencyBuckets]uint64
+    total  uint64
+}
+
+func bucketOf(d time.Duration) int {
+    if d <= 1 {
+        return 0
+    }
+    i := int(math.Log2(float64(d)) * bucketsPerOctave)
+    if i >= latencyBuckets {
+        i = latencyBuckets - 1
+    }
+    return i
+}
+
+// upper bound of bucket i
+func bucketBound(i int) time.Duration {
+    return time.Duration(math.Pow(2, float64(i+1)/bucketsPerOctave))
+}
+
+func (h *histogram) observe(d time.Duration) {
+    h.counts[bucketOf(d)]++
+    h.total++
+}
+
+// duration below which a fraction q of the observations fall
+func (h *histogram) quantile(q float64) time.Duration {
+    if h.total == 0 {
+        return 0
+    }
+    rank := uint64(math.Ceil(q * float64(h.total)))
+    var seen uint64
+    for i, c := range h.counts {
+        seen += c
+        if seen >= rank {
+            return bucketBound(i)
+        }
+    }
+    return bucketBound(latencyBuckets - 1)
+}
+
+// latency histograms keyed by provider operation
+type latencyStats struct {
+    lock  sync.Mutex
+    hists map[string]*histogram
+}
+
+func (ls *latencyStats) observe(op string, d time.Duration) {
+    ls.lock.Lock()
+    defer ls.lock.Unlock()
+    if ls.hists == nil {
+        ls.hists = make(map[string]*histogram)
+    }
+    h, ok := ls.hists[op]
+    if !ok {
+        h = &histogram{}
+        ls.hists[op] = h
+    }
+    h.observe(d)
+}
+
+// LatencyStats report p50/p95/p99 latency of each provider operation
+// (SessionInit, SessionRead, SessionDestroy) issued by the manager
+func (manager *Manager) LatencyStats() map[string]LatencyStat {
+    ls := &manager.latency
+    ls.lock.Lock()
+    defer ls.lock.Unlock()
+    stats := make(map[string]LatencyStat, len(ls.hists))
+    for op, h := range ls.hists {
+        stats[op] = LatencyStat{Count: h.total, P50: h.quantile(0.50), P95: h.quantile(0.95), P99: h.quantile(0.99)}
+    }
+    return stats
+}
+
+func (manager *Manager) observe(op string, start time.Time) {
+    manager.latency.observe(op, time.Since(start))
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestHistogramQuantiles(t *testing.T) {
+    var h histogram
+    for i := 0; i < 90; i++ {
+        h.observe(time.Millisecond)
+    }
+    for i := 0; i < 10; i++ {
+        h.observe(time.Second)
+    }
+    // a bucket is ~19% wide, its bound is at most that above the observation
+    within := func(got, want time.Duration) bool {
+        return got >= want && float64(got) <= float64(want)*1.2
+    }
+    if p50 := h.quantile(0.50); !within(p50, time.Millisecond) {
+        t.Errorf("p50 = %v, want about 1ms", p50)
+    }
+    if p95 := h.quantile(0.95); !within(p95, time.Second) {
+        t.Errorf("p95 = %v, want about 1s", p95)
+    }
+    var empty histogram
+    if q := empty.quantile(0.99); q != 0 {
+        t.Errorf("quantile of an empty histogram = %v, want 0", q)
+    }
+}
+
+func TestLatencyStatsCountsProviderCalls(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, c := startNew(t, manager)
+    manager.SessionStart(httptest.NewRecorder(), requestWith(c))
+    manager.SessionEnd(httptest.NewRecorder(), s)
+
+    stats := manager.LatencyStats()
+    for op, want := range map[string]uint64{"SessionInit": 1, "SessionRead": 1, "SessionDestroy": 1} {
+        if got := stats[op].Count; got != want {
+            t.Errorf("%s count = %d, want %d", op, got, want)
+        }
+    }
+}
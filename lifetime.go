@@ -0,0 +1,76 @@
+package session
+
+import (
+    "context"
+    "net/http"
+    log "github.com/cihub/seelog"
+)
+
+// reserved key holding the lifetime given with WithLifetime, in seconds
+const keyLifetime = "_session_lifetime"
+
+// Renewer is implemented by providers which can give one session a lifetime
+// other than the manager's, in seconds of inactivity
+type Renewer interface {
+    SetLifetime(sid string, lifetime int64) error
+}
+
+// WithLifetime return a copy of ctx telling SessionStart to give a session
+// it creates a lifetime of seconds instead of the manager's: the cookie
+// MaxAge, and the provider expiry when the provider is a Renewer. the
+// lifetime is stored with the session, later cookies and the sessions
+// replacing it on Login or rotation keep it
+func WithLifetime(ctx context.Context, seconds int64) context.Context {
+    return context.WithValue(ctx, lifetimeContextKey, seconds)
+}
+
+// lifetime for cookies sent in response to r
+func (manager *Manager) lifetimeFor(r *http.Request) int64 {
+    if r != nil {
+        if seconds, ok := r.Context().Value(lifetimeContextKey).(int64); ok && seconds > 0 {
+            return seconds
+        }
+    }
+    return manager.maxlifetime
+}
+
+// lifetime for cookies of session sent in response to r: the one session
+// was created with, otherwise the one for r
+func (manager *Manager) cookieLifetime(session Session, r *http.Request) int64 {
+    if session != nil {
+        if seconds, ok := session.Get(keyLifetime).(int64); ok && seconds > 0 {
+            return seconds
+        }
+    }
+    return manager.lifetimeFor(r)
+}
+
+// r asking for the lifetime session was created with, unless r asks for its
+// own. used when session is replaced by a new one for r
+func (manager *Manager) keepLifetime(r *http.Request, session Session) *http.Request {
+    if _, ok := r.Context().Value(lifetimeContextKey).(int64); ok {
+        return r
+    }
+    if seconds, ok := session.Get(keyLifetime).(int64); ok && seconds > 0 {
+        return r.WithContext(WithLifetime(r.Context(), seconds))
+    }
+    return r
+}
+
+// store a lifetime requested by the context of r with session and pass it on
+// to the provider, caller must hold the lock
+func (manager *Manager) applyLifetime(session Session, r *http.Request) {
+    lifetime := manager.lifetimeFor(r)
+    if lifetime == manager.maxlifetime {
+        return
+    }
+    session.Set(keyLifetime, lifetime)
+    renewer, ok := manager.provider.(Renewer)
+    if !ok {
+        log.Warnf("provider can't change the lifetime of session %s, only the cookie expires early", manager.redactSID(session.SessionID()))
+        return
+    }
+    if err := renewer.SetLifetime(manager.storeKey(session.SessionID()), lifetime); err != nil {
+        log.Errorf("set lifetime of session %s failed: %v", manager.redactSID(session.SessionID()), err)
+    }
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// renewerProvider is a fakeProvider which is a Renewer, recording the lifetimes
+type renewerProvider struct {
+    *fakeProvider
+    lifetimes map[string]int64
+}
+
+func (p *renewerProvider) SetLifetime(sid string, lifetime int64) error {
+    p.lifetimes[sid] = lifetime
+    return nil
+}
+
+// start a session with a lifetime of seconds, return it with its cookies
+func startWithLifetime(t *testing.T, manager *Manager, seconds int64) (Session, []*http.Cookie) {
+    t.Helper()
+    r := requestWith()
+    r = r.WithContext(WithLifetime(r.Context(), seconds))
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, r)
+    c := responseCookie(rec, "sid")
+    if c == nil || c.MaxAge != int(seconds) {
+        t.Fatalf("cookie %v, want a MaxAge of %d", c, seconds)
+    }
+    return s, rec.Result().Cookies()
+}
+
+func TestWithLifetime(t *testing.T) {
+    p := &renewerProvider{fakeProvider: newFakeProvider(), lifetimes: make(map[string]int64)}
+    manager := newManagerOn(t, p)
+    s, _ := startWithLifetime(t, manager, 300)
+    if p.lifetimes[s.SessionID()] != 300 {
+        t.Fatalf("provider lifetimes %v, want 300 for the session", p.lifetimes)
+    }
+
+    _, c := startNew(t, manager)
+    if c.MaxAge != 3600 || len(p.lifetimes) != 1 {
+        t.Fatalf("session without a lifetime: cookie MaxAge %d, lifetimes %v, want the manager's", c.MaxAge, p.lifetimes)
+    }
+}
+
+func TestLifetimeKeptOnNonceRoll(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetRollingNonce(true)
+    logged := captureLog(t)
+    s, cookies := startWithLifetime(t, manager, 300)
+    // the fakeProvider isn't a Renewer
+    if out := logged.String(); strings.Contains(out, s.SessionID()) || !strings.Contains(out, "only the cookie expires early") {
+        t.Fatalf("missing Renewer warning shows the sid or is missing:\n%s", out)
+    }
+    _, _, nonce := resume(manager, cookies...)
+    if nonce == nil || nonce.MaxAge != 300 {
+        t.Fatalf("rolled nonce cookie %v, want the session's MaxAge of 300", nonce)
+    }
+}
+
+func TestLifetimeKeptOnLogin(t *testing.T) {
+    p := &renewerProvider{fakeProvider: newFakeProvider(), lifetimes: make(map[string]int64)}
+    manager := newManagerOn(t, p)
+    old, cookies := startWithLifetime(t, manager, 300)
+    rec := httptest.NewRecorder()
+    s, err := manager.Login(rec, requestWith(cookies...), "alice")
+    if err != nil {
+        t.Fatalf("Login: %v", err)
+    }
+    if s.SessionID() == old.SessionID() {
+        t.Fatal("Login kept the session id")
+    }
+    if c := responseCookie(rec, "sid"); c == nil || c.MaxAge != 300 || p.lifetimes[s.SessionID()] != 300 {
+        t.Fatalf("login cookie %v, lifetimes %v, want the old lifetime of 300", c, p.lifetimes)
+    }
+}
+
+func TestLifetimeKeptOnReplace(t *testing.T) {
+    manager, _ := newTestManager(t)
+    now := time.Unix(1700000000, 0)
+    manager.SetClock(func() time.Time { return now })
+    manager.SetAbsoluteTimeout(time.Hour)
+    old, cookies := startWithLifetime(t, manager, 300)
+
+    now = now.Add(2 * time.Hour)
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, requestWith(cookies...))
+    if s.SessionID() == old.SessionID() {
+        t.Fatal("session past the absolute timeout wasn't replaced")
+    }
+    if c := responseCookie(rec, "sid"); c == nil || c.MaxAge != 300 {
+        t.Fatalf("replacement cookie %v, want the old lifetime of 300", c)
+    }
+}
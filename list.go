@@ -0,0 +1,30 @@
+package session
+
+import "errors"
+
+// PagedLister is implemented by providers which can enumerate their sessions
+// a page at a time. cursor is "" for the first page and the returned next for
+// the following ones, next is "" after the last page. the format of cursors
+// is up to the provider
+type PagedLister interface {
+    ListSessions(cursor string, limit int) (sids []string, next string, err error)
+}
+
+// DefaultListLimit is the page size ListSessions uses for a limit <= 0
+const DefaultListLimit = 100
+
+// ListSessions return up to limit sids stored by the provider, starting at
+// cursor, see PagedLister. with SetHashStoreKeys the returned ids are the
+// store keys. sessions created or destroyed while paging may or may not show
+func (manager *Manager) ListSessions(cursor string, limit int) (ids []string, next string, err error) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    lister, ok := manager.provider.(PagedLister)
+    if !ok {
+        return nil, "", errors.New("session: provider can't list sessions")
+    }
+    if limit <= 0 {
+        limit = DefaultListLimit
+    }
+    return lister.ListSessions(cursor, limit)
+}
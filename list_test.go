@@ -0,0 +1,41 @@
+package session
+
+import "testing"
+
+// listerProvider is a fakeProvider which is a PagedLister, recording the limits
+type listerProvider struct {
+    *fakeProvider
+    limits []int
+}
+
+func (p *listerProvider) ListSessions(cursor string, limit int) ([]string, string, error) {
+    p.limits = append(p.limits, limit)
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    var sids []string
+    for sid := range p.sessions {
+        sids = append(sids, sid)
+    }
+    return sids, "", nil
+}
+
+func TestListSessions(t *testing.T) {
+    if _, _, err := newManagerOn(t, newFakeProvider()).ListSessions("", 10); err == nil {
+        t.Fatal("ListSessions succeeded on a provider which can't list")
+    }
+
+    p := &listerProvider{fakeProvider: newFakeProvider()}
+    manager := newManagerOn(t, p)
+    manager.SetHashStoreKeys(true)
+    s, _ := startNew(t, manager)
+    ids, _, err := manager.ListSessions("", 0)
+    if err != nil {
+        t.Fatalf("ListSessions: %v", err)
+    }
+    if len(p.limits) != 1 || p.limits[0] != DefaultListLimit {
+        t.Fatalf("provider got limits %v, want DefaultListLimit for 0", p.limits)
+    }
+    if len(ids) != 1 || ids[0] != manager.storeKey(s.SessionID()) {
+        t.Fatalf("ids = %v, want the store key of the session", ids)
+    }
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+    "net/http"
+    log "github.com/cihub/seelog"
+)
+
+// Login promote the current (possibly anonymous) session of r to an
+// authenticated one: the values are moved to a session with a new sid,
+// the user id is set, the old session is destroyed (running the destroy
+// callback) and the new sid sent like SessionStart sends it
+func (manager *Manager) Login(w http.ResponseWriter, r *http.Request, userID string) (Session, error) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    if !manager.tlsOK(r) {
+        return nil, ErrTLSRequired
+    }
+
+    var old Session
+    if manager.tokenSources != nil {
+        old, _ = manager.sourceSession(r)
+    } else if sid := manager.transportSID(r, manager.transportFor(r)); sid != "" {
+        var err error
+        old, err = manager.sessionRead(r.Context(), sid)
+        if err != nil {
+            return nil, err
+        }
+        if old != nil && manager.dropRevoked(old) {
+            old = nil
+        }
+    }
+
+    session, err := manager.createSession(r.Context())
+    if err != nil {
+        return nil, err
+    }
+    if snap, ok := unwrapSession(old).(Snapshotter); ok {
+        for k, v := range snap.Snapshot() {
+            if !isReserved(k) || k == keyReturnTo {
+                session.Set(k, v)
+            }
+        }
+    }
+    session.Set(keyUserID, userID)
+
+    if old != nil {
+        r = manager.keepLifetime(r, old)
+        manager.notifyDestroy(old)
+        if err := manager.sessionDestroy(old.SessionID()); err != nil {
+            log.Errorf("destroy session for id %s failed\n", manager.redactSID(old.SessionID()))
+        }
+    }
+    manager.bindNew(w, r, session)
+    log.Infof("audit: user %s logged in, session rotated to %s", userID, manager.redactSID(session.SessionID()))
+    return session, nil
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+)
+
+func TestLogin(t *testing.T) {
+    manager, p := newTestManager(t)
+    var destroyed []string
+    manager.SetOnDestroy(func(sid string, values map[interface{}]interface{}) {
+        destroyed = append(destroyed, sid)
+    })
+    old, c := startNew(t, manager)
+    old.Set("cart", 3)
+    old.Set(keyReturnTo, "/checkout")
+    old.Set(keyNonce, "stale")
+
+    rec := httptest.NewRecorder()
+    s, err := manager.Login(rec, requestWith(c), "alice")
+    if err != nil {
+        t.Fatalf("Login: %v", err)
+    }
+    if s.SessionID() == old.SessionID() {
+        t.Fatal("Login kept the sid")
+    }
+    if s.Get("cart") != 3 || s.Get(keyReturnTo) != "/checkout" || s.Get(keyUserID) != "alice" {
+        t.Fatalf("logged in session = %v, want cart, return to and user id", s.(Snapshotter).Snapshot())
+    }
+    if s.Get(keyNonce) != nil {
+        t.Fatal("Login carried a reserved key over")
+    }
+    if p.stored(old.SessionID()) != nil {
+        t.Fatal("Login left the anonymous session")
+    }
+    if len(destroyed) != 1 || destroyed[0] != old.SessionID() {
+        t.Fatalf("destroy callback got %v, want the anonymous sid", destroyed)
+    }
+    if nc := responseCookie(rec, "sid"); nc == nil || nc.Value != url.QueryEscape(s.SessionID()) {
+        t.Fatalf("Login cookie = %v, want the new sid", nc)
+    }
+}
+
+func TestLoginHeaderTransport(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetTransportSelector(func(r *http.Request) Transport { return Header })
+    old := manager.ApiSessionCreate()
+
+    rec := httptest.NewRecorder()
+    s, err := manager.Login(rec, apiRequest(old.SessionID()), "alice")
+    if err != nil {
+        t.Fatalf("Login: %v", err)
+    }
+    if p.stored(old.SessionID()) != nil {
+        t.Fatal("Login did not find the session sent in the header")
+    }
+    if got := rec.Header().Get(tokenHeader); got != url.QueryEscape(s.SessionID()) {
+        t.Fatalf("%s = %q, want the new sid", tokenHeader, got)
+    }
+    if responseCookie(rec, "sid") != nil {
+        t.Fatal("Login wrote a cookie for the header transport")
+    }
+}
+
+func TestLoginRollingNonce(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetRollingNonce(true)
+    _, c := startNew(t, manager)
+
+    rec := httptest.NewRecorder()
+    s, err := manager.Login(rec, requestWith(c), "alice")
+    if err != nil {
+        t.Fatalf("Login: %v", err)
+    }
+    nonce := responseCookie(rec, manager.nonceCookieName())
+    if nonce == nil || nonce.Value != s.Get(keyNonce) {
+        t.Fatalf("nonce cookie = %v, want the nonce of the new session", nonce)
+    }
+    resumed := manager.SessionStart(httptest.NewRecorder(), requestWith(responseCookie(rec, "sid"), nonce))
+    if resumed.SessionID() != s.SessionID() {
+        t.Fatal("session from Login failed the nonce check")
+    }
+}
+
+func TestLoginAuditLogRedactsSID(t *testing.T) {
+    manager, _ := newTestManager(t)
+    logged := captureLog(t)
+    s, err := manager.Login(httptest.NewRecorder(), requestWith(), "alice")
+    if err != nil {
+        t.Fatalf("Login: %v", err)
+    }
+    out := logged.String()
+    if strings.Contains(out, s.SessionID()) || !strings.Contains(out, "audit: user alice logged in, session rotated to "+manager.redactSID(s.SessionID())) {
+        t.Fatalf("audit log shows the sid or misses the login:\n%s", out)
+    }
+}
@@ -0,0 +1,43 @@
+package session
+
+import (
+    "errors"
+    "net/http"
+)
+
+// response writer only collecting headers
+type headerRecorder struct {
+    header http.Header
+}
+
+func (hr *headerRecorder) Header() http.Header         { return hr.header }
+func (hr *headerRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (hr *headerRecorder) WriteHeader(code int)        {}
+
+// SessionStartManual behave like SessionStart without writing to a response,
+// for frameworks which send headers themselves. the returned cookie is the
+// session cookie the caller must set, nil when the client already holds it.
+// other headers SessionStart would send, like the nonce cookie, are dropped,
+// so combine it with neither SetRollingNonce nor the Header transport
+func (manager *Manager) SessionStartManual(r *http.Request) (Session, *http.Cookie, error) {
+    manager.lock.Lock()
+    ok := manager.tlsOK(r)
+    manager.lock.Unlock()
+    if !ok {
+        return nil, nil, ErrTLSRequired
+    }
+    rec := &headerRecorder{header: make(http.Header)}
+    session := manager.SessionStart(rec, r)
+    if session == nil {
+        return nil, nil, errors.New("session: can't start session")
+    }
+    manager.lock.Lock()
+    name := manager.cookieNameInUse()
+    manager.lock.Unlock()
+    for _, c := range (&http.Response{Header: rec.header}).Cookies() {
+        if c.Name == name {
+            return session, c, nil
+        }
+    }
+    return session, nil, nil
+}
@@ -0,0 +1,27 @@
+package session
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestSessionStartManual(t *testing.T) {
+    manager, p := newTestManager(t)
+    s, c, err := manager.SessionStartManual(requestWith())
+    if err != nil || s == nil {
+        t.Fatalf("SessionStartManual = %v, %v", s, err)
+    }
+    if c == nil || c.Name != "sid" || p.stored(s.SessionID()) == nil {
+        t.Fatalf("new session returned cookie %v, want the one to set", c)
+    }
+
+    got, again, err := manager.SessionStartManual(requestWith(c))
+    if err != nil || got.SessionID() != s.SessionID() || again != nil {
+        t.Fatalf("existing session = %v, cookie %v, %v, want it without a cookie", got, again, err)
+    }
+
+    manager.SetRequireTLS(true)
+    if _, _, err := manager.SessionStartManual(requestWith()); !errors.Is(err, ErrTLSRequired) {
+        t.Fatalf("plain http request with TLS required = %v, want ErrTLSRequired", err)
+    }
+}
@@ -0,0 +1,148 @@
+package session
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    log "github.com/cihub/seelog"
+)
+
+type contextKey int
+
+const (
+    sessionContextKey contextKey = iota
+    correlationContextKey
+    lifetimeContextKey
+)
+
+// NewContext return a copy of ctx carrying s
+func NewContext(ctx context.Context, s Session) context.Context {
+    return context.WithValue(ctx, sessionContextKey, s)
+}
+
+// FromContext return the session stored in ctx by NewContext or the middleware
+func FromContext(ctx context.Context) (Session, bool) {
+    s, ok := ctx.Value(sessionContextKey).(Session)
+    return s, ok
+}
+
+// set the headers and body RequireSession answers 401 with,
+// default is a plain text "Unauthorized"
+func (manager *Manager) SetUnauthorizedResponse(header http.Header, body []byte) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.unauthorizedHeader = header
+    manager.unauthorizedBody = body
+}
+
+// set the request methods the middlewares pass straight to next without
+// starting or looking up a session, default is OPTIONS (CORS preflight).
+// no methods means every request gets a session
+func (manager *Manager) SetSkipMethods(methods ...string) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.skipMethods = make(map[string]bool, len(methods))
+    for _, m := range methods {
+        manager.skipMethods[strings.ToUpper(m)] = true
+    }
+}
+
+func (manager *Manager) skipped(r *http.Request) bool {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    if manager.skipMethods == nil {
+        return r.Method == http.MethodOptions
+    }
+    return manager.skipMethods[r.Method]
+}
+
+// Handler start a session for every request, see SessionStart, put it in
+// the request context and call next with w wrapped by TrackHeaders.
+// methods set by SetSkipMethods skip it. requests refused by SetRequireTLS
+// get 403 and don't reach next
+func (manager *Manager) Handler(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if manager.skipped(r) {
+            next.ServeHTTP(w, r)
+            return
+        }
+        w = TrackHeaders(w)
+        session := manager.SessionStart(w, r)
+        if session == nil {
+            // refused by SetRequireTLS
+            http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+            return
+        }
+        next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), session)))
+    })
+}
+
+// sid sent with the request, from the session cookie or the api token header
+func (manager *Manager) requestSID(r *http.Request) string {
+    if sid := manager.transportSID(r, Cookie); sid != "" {
+        return sid
+    }
+    return manager.transportSID(r, Header)
+}
+
+// read an existing session without creating one, caller must hold the lock.
+// a session the provider made up for an unknown sid is destroyed and nil returned
+func (manager *Manager) lookup(ctx context.Context, sid string) Session {
+    if sid == "" {
+        return nil
+    }
+    session, err := manager.sessionRead(ctx, sid)
+    if err != nil {
+        log.Debugf("read session for id %s failed: %v", sid, err)
+        return nil
+    }
+    if session == nil {
+        return nil
+    }
+    if manager.dropRevoked(session) {
+        return nil
+    }
+    if session.Get(keyCreatedAt) == nil {
+        if err := manager.sessionDestroy(sid); err != nil {
+            log.Errorf("destroy session for id %s failed\n", manager.redactSID(sid))
+        }
+        return nil
+    }
+    return session
+}
+
+// RequireSession answer 401 to requests without a valid session, never
+// creating one. otherwise the session is put in the request context, see
+// FromContext, and next is called. methods set by SetSkipMethods are passed
+// to next without a session
+func (manager *Manager) RequireSession(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if manager.skipped(r) {
+            next.ServeHTTP(w, r)
+            return
+        }
+        manager.lock.Lock()
+        session := manager.lookup(r.Context(), manager.requestSID(r))
+        if session != nil {
+            manager.touch(session)
+        }
+        header, body := manager.unauthorizedHeader, manager.unauthorizedBody
+        manager.lock.Unlock()
+
+        if session == nil {
+            if header == nil && body == nil {
+                http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+                return
+            }
+            for k, vs := range header {
+                for _, v := range vs {
+                    w.Header().Add(k, v)
+                }
+            }
+            w.WriteHeader(http.StatusUnauthorized)
+            w.Write(body)
+            return
+        }
+        next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), session)))
+    })
+}
@@ -0,0 +1,95 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// handler recording the session it was called with
+func recordSession(got *Session, called *bool) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        *called = true
+        *got, _ = FromContext(r.Context())
+    })
+}
+
+func TestRequireSession(t *testing.T) {
+    manager, p := newTestManager(t)
+    var got Session
+    var called bool
+    h := manager.RequireSession(recordSession(&got, &called))
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, requestWith())
+    if rec.Code != http.StatusUnauthorized || called {
+        t.Fatalf("request without session answered %d, next called %v, want 401", rec.Code, called)
+    }
+
+    unknown := manager.sessionId()
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, apiRequest(unknown))
+    if rec.Code != http.StatusUnauthorized || p.stored(unknown) != nil {
+        t.Fatalf("unknown token answered %d, stored %v, want 401 and nothing stored", rec.Code, p.stored(unknown) != nil)
+    }
+
+    s, c := startNew(t, manager)
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, requestWith(c))
+    if !called || got == nil || got.SessionID() != s.SessionID() {
+        t.Fatalf("valid cookie: next called %v with %v, want the session", called, got)
+    }
+    if responseCookie(rec, "sid") != nil {
+        t.Fatal("RequireSession wrote a cookie")
+    }
+}
+
+func TestUnauthorizedResponse(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetUnauthorizedResponse(http.Header{"Content-Type": {"application/json"}}, []byte(`{"error":"login"}`))
+    var got Session
+    var called bool
+    rec := httptest.NewRecorder()
+    manager.RequireSession(recordSession(&got, &called)).ServeHTTP(rec, requestWith())
+    if rec.Code != http.StatusUnauthorized || rec.Header().Get("Content-Type") != "application/json" || rec.Body.String() != `{"error":"login"}` {
+        t.Fatalf("answer %d %v %q, want the configured 401", rec.Code, rec.Header(), rec.Body.String())
+    }
+}
+
+func TestSkipMethods(t *testing.T) {
+    manager, p := newTestManager(t)
+    var got Session
+    var called bool
+    h := manager.Handler(recordSession(&got, &called))
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/", nil))
+    if !called || got != nil || responseCookie(rec, "sid") != nil || p.reads != 0 || len(p.sessions) != 0 {
+        t.Fatalf("preflight: next called %v with %v, cookie %v, %d reads, want no session work",
+            called, got, responseCookie(rec, "sid"), p.reads)
+    }
+
+    called = false
+    rec = httptest.NewRecorder()
+    h.ServeHTTP(rec, requestWith())
+    if !called || got == nil || responseCookie(rec, "sid") == nil {
+        t.Fatalf("GET: next called %v with %v, want a session and its cookie", called, got)
+    }
+
+    manager.SetSkipMethods("head")
+    called, got = false, nil
+    h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodHead, "/", nil))
+    if !called || got != nil {
+        t.Fatalf("HEAD after SetSkipMethods: next called %v with %v, want no session", called, got)
+    }
+    h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodOptions, "/", nil))
+    if got == nil {
+        t.Fatal("OPTIONS still skipped after SetSkipMethods replaced the methods")
+    }
+
+    called = false
+    manager.RequireSession(recordSession(&got, &called)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodHead, "/", nil))
+    if !called {
+        t.Fatal("RequireSession refused a skipped method")
+    }
+}
@@ -0,0 +1,33 @@
+package session
+
+import (
+    "fmt"
+)
+
+// reserved key holding the schema version of a session
+const keyVersion = "_session_version"
+
+// Migration upgrade the values of a session from one schema version to the next
+type Migration func(s Session) error
+
+// set the schema migrations, migrations[n] upgrades a session from version n
+// to n+1. sessions read from the provider get the pending ones applied in
+// order, new sessions start at len(migrations). sessions without a version are at 0
+func (manager *Manager) SetMigrations(migrations []Migration) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.migrations = migrations
+}
+
+// apply the pending migrations to s
+func (manager *Manager) migrate(s Session) error {
+    v, _ := s.Get(keyVersion).(int64)
+    for v < int64(len(manager.migrations)) {
+        if err := manager.migrations[v](s); err != nil {
+            return fmt.Errorf("session: migrate from version %d: %v", v, err)
+        }
+        v++
+        s.Set(keyVersion, v)
+    }
+    return nil
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+    "context"
+    "errors"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestMigrations(t *testing.T) {
+    manager, p := newTestManager(t)
+    s, c := startNew(t, manager)
+    // written before the migrations existed, so at version 0
+    s.Set("name", "Alice Smith")
+
+    var ran []int
+    manager.SetMigrations([]Migration{
+        func(s Session) error {
+            ran = append(ran, 0)
+            return s.Rename("name", "full_name")
+        },
+        func(s Session) error {
+            ran = append(ran, 1)
+            return s.Set("locale", "en")
+        },
+    })
+    got := manager.SessionStart(httptest.NewRecorder(), requestWith(c))
+    if len(ran) != 2 || got.Get("full_name") != "Alice Smith" || got.Get("locale") != "en" {
+        t.Fatalf("migrations ran %v, session %v", ran, p.stored(s.SessionID()).Snapshot())
+    }
+    if v := got.Get(keyVersion); v != int64(2) {
+        t.Fatalf("version after migrating = %v, want 2", v)
+    }
+
+    manager.SessionStart(httptest.NewRecorder(), requestWith(c))
+    if len(ran) != 2 {
+        t.Fatalf("migrations ran again on a current session: %v", ran)
+    }
+    if v := manager.ApiSessionCreate().Get(keyVersion); v != int64(2) {
+        t.Fatalf("new session at version %v, want 2", v)
+    }
+}
+
+func TestMigrationFailure(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s := manager.ApiSessionCreate()
+    manager.SetMigrations([]Migration{func(s Session) error { return errors.New("bad data") }})
+    if _, err := readWithLock(manager, context.Background(), s.SessionID()); err == nil {
+        t.Fatal("read of a session failing its migration succeeded")
+    }
+    if v := s.Get(keyVersion); v != nil {
+        t.Fatalf("failed migration set the version to %v", v)
+    }
+}
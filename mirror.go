@@ -0,0 +1,230 @@
+package session
+
+import (
+    "errors"
+    "sync"
+    log "github.com/cihub/seelog"
+)
+
+// MirrorProvider serve sessions from Primary and repeat every write on
+// Secondary, e.g. to warm up a new store before switching to it. failures
+// of Secondary are logged and otherwise ignored. reads only use Primary.
+// a session first written after the mirror started is copied whole to
+// Secondary. the optional provider interfaces are those of Primary
+type MirrorProvider struct {
+    Primary   Provider
+    Secondary Provider
+}
+
+func (p *MirrorProvider) SessionInit(sid string) (Session, error) {
+    session, err := p.Primary.SessionInit(sid)
+    if err != nil {
+        return nil, err
+    }
+    secondary, err := p.Secondary.SessionInit(sid)
+    if err != nil {
+        log.Warnf("session: mirror init of %s failed: %v", RedactKey(sid), err)
+        secondary = nil
+    }
+    return &mirroredSession{Session: session, pder: p, secondary: secondary}, nil
+}
+
+func (p *MirrorProvider) SessionRead(sid string) (Session, error) {
+    session, err := p.Primary.SessionRead(sid)
+    if err != nil || session == nil {
+        return session, err
+    }
+    return &mirroredSession{Session: session, pder: p}, nil
+}
+
+func (p *MirrorProvider) SessionDestroy(sid string) error {
+    if err := p.Secondary.SessionDestroy(sid); err != nil {
+        log.Warnf("session: mirror destroy of %s failed: %v", RedactKey(sid), err)
+    }
+    return p.Primary.SessionDestroy(sid)
+}
+
+func (p *MirrorProvider) SessionGC(maxlifetime int64) {
+    p.Primary.SessionGC(maxlifetime)
+    p.Secondary.SessionGC(maxlifetime)
+}
+
+// OnGC forward to Primary, if it is a GCReporter
+func (p *MirrorProvider) OnGC(report func(collected int)) {
+    if r, ok := p.Primary.(GCReporter); ok {
+        r.OnGC(report)
+    }
+}
+
+// OnExpire forward to Primary, if it is an ExpiryNotifier
+func (p *MirrorProvider) OnExpire(notify func(sid string, values map[interface{}]interface{})) {
+    if n, ok := p.Primary.(ExpiryNotifier); ok {
+        n.OnExpire(notify)
+    }
+}
+
+// SetLifetime forward to Primary and Secondary, Primary must be a Renewer
+func (p *MirrorProvider) SetLifetime(sid string, lifetime int64) error {
+    r, ok := p.Primary.(Renewer)
+    if !ok {
+        return errors.New("session: mirror primary can't change lifetimes")
+    }
+    if err := r.SetLifetime(sid, lifetime); err != nil {
+        return err
+    }
+    if r, ok := p.Secondary.(Renewer); ok {
+        if err := r.SetLifetime(sid, lifetime); err != nil {
+            log.Warnf("session: mirror lifetime of %s failed: %v", RedactKey(sid), err)
+        }
+    }
+    return nil
+}
+
+// ListSessions forward to Primary, which must be a PagedLister
+func (p *MirrorProvider) ListSessions(cursor string, limit int) ([]string, string, error) {
+    if l, ok := p.Primary.(PagedLister); ok {
+        return l.ListSessions(cursor, limit)
+    }
+    return nil, "", errors.New("session: provider can't list sessions")
+}
+
+// SetIntegrityCheck forward to Primary and Secondary, where they are IntegrityCheckers
+func (p *MirrorProvider) SetIntegrityCheck(check bool) {
+    for _, pder := range []Provider{p.Primary, p.Secondary} {
+        if c, ok := pder.(IntegrityChecker); ok {
+            c.SetIntegrityCheck(check)
+        }
+    }
+}
+
+// SetGCRateLimit forward to Primary and Secondary, where they are GCRateLimiters
+func (p *MirrorProvider) SetGCRateLimit(opsPerSec int) {
+    for _, pder := range []Provider{p.Primary, p.Secondary} {
+        if l, ok := pder.(GCRateLimiter); ok {
+            l.SetGCRateLimit(opsPerSec)
+        }
+    }
+}
+
+// WriteDiff write the changes to Primary, and repeat them on Secondary
+func (p *MirrorProvider) WriteDiff(sid string, set map[interface{}]interface{}, deleted []interface{}) error {
+    if err := writeDiff(p.Primary, sid, set, deleted); err != nil {
+        return err
+    }
+    if err := writeDiff(p.Secondary, sid, set, deleted); err != nil {
+        log.Warnf("session: mirror diff of %s failed: %v", RedactKey(sid), err)
+    }
+    return nil
+}
+
+// write the changes to sid with WriteDiff if pder is a DiffWriter,
+// otherwise on the session read from pder
+func writeDiff(pder Provider, sid string, set map[interface{}]interface{}, deleted []interface{}) error {
+    if dw, ok := pder.(DiffWriter); ok {
+        return dw.WriteDiff(sid, set, deleted)
+    }
+    s, err := pder.SessionRead(sid)
+    if err != nil {
+        return err
+    }
+    return applyChanges(s, set, deleted)
+}
+
+// session of Primary whose writes are repeated on the Secondary one
+type mirroredSession struct {
+    Session
+    pder      *MirrorProvider
+    lock      sync.Mutex
+    secondary Session // read from Secondary on the first write
+}
+
+// the Secondary session, nil if it can't be had. on the first call it is
+// made to hold the values of the Primary one
+func (st *mirroredSession) mirror() Session {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if st.secondary == nil {
+        sid := st.Session.SessionID()
+        s, err := st.pder.Secondary.SessionRead(sid)
+        if err != nil {
+            log.Warnf("session: mirror read of %s failed: %v", RedactKey(sid), err)
+            return nil
+        }
+        if err := st.seed(s); err != nil {
+            log.Warnf("session: mirror seed of %s failed: %v", RedactKey(sid), err)
+            return nil
+        }
+        st.secondary = s
+    }
+    return st.secondary
+}
+
+// run write on the Secondary session, logging a failure
+func (st *mirroredSession) repeat(op string, write func(s Session) error) {
+    if s := st.mirror(); s != nil {
+        if err := write(s); err != nil {
+            log.Warnf("session: mirror %s on %s failed: %v", op, RedactKey(st.Session.SessionID()), err)
+        }
+    }
+}
+
+func (st *mirroredSession) Set(key, value interface{}) error {
+    if err := st.Session.Set(key, value); err != nil {
+        return err
+    }
+    st.repeat("set", func(s Session) error { return s.Set(key, value) })
+    return nil
+}
+
+func (st *mirroredSession) Delete(key interface{}) error {
+    if err := st.Session.Delete(key); err != nil {
+        return err
+    }
+    st.repeat("delete", func(s Session) error { return s.Delete(key) })
+    return nil
+}
+
+func (st *mirroredSession) Rename(oldKey, newKey interface{}) error {
+    if err := st.Session.Rename(oldKey, newKey); err != nil {
+        return err
+    }
+    st.repeat("rename", func(s Session) error { return s.Rename(oldKey, newKey) })
+    return nil
+}
+
+func (st *mirroredSession) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    if err := applyChanges(st.Session, set, deleted); err != nil {
+        return err
+    }
+    st.repeat("apply", func(s Session) error { return applyChanges(s, set, deleted) })
+    return nil
+}
+
+func (st *mirroredSession) Begin() (Session, func() error) {
+    return NewView(st)
+}
+
+func (st *mirroredSession) Snapshot() map[interface{}]interface{} {
+    if snap, ok := st.Session.(Snapshotter); ok {
+        return snap.Snapshot()
+    }
+    return nil
+}
+
+// copy the values of the Primary session to s, dropping those it lacks
+func (st *mirroredSession) seed(s Session) error {
+    snap, ok := st.Session.(Snapshotter)
+    if !ok {
+        return nil
+    }
+    values := snap.Snapshot()
+    var deleted []interface{}
+    if old, ok := s.(Snapshotter); ok {
+        for k := range old.Snapshot() {
+            if _, ok := values[k]; !ok {
+                deleted = append(deleted, k)
+            }
+        }
+    }
+    return applyChanges(s, values, deleted)
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+func newTestMirror() (*MirrorProvider, *fakeProvider, *fakeProvider) {
+    primary, secondary := newFakeProvider(), newFakeProvider()
+    return &MirrorProvider{Primary: primary, Secondary: secondary}, primary, secondary
+}
+
+func TestMirrorRepeatsWrites(t *testing.T) {
+    p, primary, secondary := newTestMirror()
+    s, err := p.SessionInit("sid1")
+    if err != nil {
+        t.Fatalf("SessionInit: %v", err)
+    }
+    s.Set("a", 1)
+    s.Set("b", 2)
+    s.Rename("b", "c")
+    s.Delete("a")
+    for name, pder := range map[string]*fakeProvider{"primary": primary, "secondary": secondary} {
+        if st := pder.stored("sid1"); st == nil || st.Get("a") != nil || st.Get("c") != 2 {
+            t.Errorf("%s holds %v, want only c", name, st)
+        }
+    }
+
+    if err := p.SessionDestroy("sid1"); err != nil {
+        t.Fatalf("SessionDestroy: %v", err)
+    }
+    if primary.stored("sid1") != nil || secondary.stored("sid1") != nil {
+        t.Fatal("SessionDestroy left the session in a store")
+    }
+}
+
+func TestMirrorSeedsSecondary(t *testing.T) {
+    p, primary, secondary := newTestMirror()
+    old, _ := primary.SessionInit("sid1")
+    old.Set("a", 1)
+    old.Set("b", 2)
+    stale, _ := secondary.SessionInit("sid1")
+    stale.Set("gone", true)
+
+    s, _ := p.SessionRead("sid1")
+    if secondary.reads != 0 {
+        t.Fatal("read of the mirror went to Secondary")
+    }
+    s.Set("c", 3)
+    got := secondary.stored("sid1").Snapshot()
+    if len(got) != 3 || got["a"] != 1 || got["b"] != 2 || got["c"] != 3 {
+        t.Fatalf("secondary after the first write = %v, want the primary values", got)
+    }
+}
+
+func TestMirrorSecondaryFailure(t *testing.T) {
+    p, primary, secondary := newTestMirror()
+    primary.SessionInit("sid1")
+    secondary.readErr = errors.New("secondary down")
+    logged := captureLog(t)
+    s, _ := p.SessionRead("sid1")
+    if err := s.Set("a", 1); err != nil {
+        t.Fatalf("Set with Secondary failing = %v, want it ignored", err)
+    }
+    if !strings.Contains(logged.String(), "WARN session: mirror read of ... failed: secondary down") {
+        t.Fatalf("Secondary failure not logged with the sid redacted, logged:\n%s", logged)
+    }
+    if primary.stored("sid1").Get("a") != 1 {
+        t.Fatal("write didn't reach Primary")
+    }
+    if err := p.WriteDiff("sid1", map[interface{}]interface{}{"b": 2}, nil); err != nil || primary.stored("sid1").Get("b") != 2 {
+        t.Fatalf("WriteDiff with Secondary failing = %v", err)
+    }
+}
+
+func TestMirrorForwarding(t *testing.T) {
+    primary := &limiterProvider{fakeProvider: newFakeProvider()}
+    secondary := &limiterProvider{fakeProvider: newFakeProvider()}
+    p := &MirrorProvider{Primary: primary, Secondary: secondary}
+    p.SetGCRateLimit(10)
+    if primary.limit != 10 || secondary.limit != 10 {
+        t.Fatalf("limits %d, %d, want both 10", primary.limit, secondary.limit)
+    }
+    if _, _, err := p.ListSessions("", 10); err == nil {
+        t.Fatal("ListSessions succeeded with a primary which can't list")
+    }
+    if err := p.SetLifetime("sid1", 60); err == nil {
+        t.Fatal("SetLifetime succeeded with a primary which can't change lifetimes")
+    }
+
+    p.SessionInit("sid1")
+    set := map[interface{}]interface{}{"a": 1}
+    if err := p.WriteDiff("sid1", set, nil); err != nil {
+        t.Fatalf("WriteDiff: %v", err)
+    }
+    if primary.stored("sid1").Get("a") != 1 || secondary.stored("sid1").Get("a") != 1 {
+        t.Fatal("WriteDiff didn't reach both stores")
+    }
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+    "crypto/subtle"
+    "encoding/base64"
+    "io"
+    "net/http"
+    "net/url"
+    log "github.com/cihub/seelog"
+)
+
+// reserved key holding the nonce the client must present next
+const keyNonce = "_session_nonce"
+
+// suffix of the cookie carrying the rolling nonce
+const nonceCookieSuffix = "_nonce"
+
+// set whether SessionStart detects cloned session cookies with a rolling nonce.
+// a nonce cookie is sent along the session cookie and replaced on every
+// request, a request presenting an outdated nonce gets the session destroyed.
+// concurrent requests of one client race for the nonce, so only enable it
+// when a client's requests are sequential. cookie transport only
+func (manager *Manager) SetRollingNonce(enable bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.rollingNonce = enable
+}
+
+func (manager *Manager) nonceCookieName() string {
+    return manager.cookieNameInUse() + nonceCookieSuffix
+}
+
+// store a fresh nonce in session and send it to the client, caller must hold the lock
+func (manager *Manager) issueNonce(w http.ResponseWriter, r *http.Request, session Session) {
+    b := make([]byte, 16)
+    if _, err := io.ReadFull(manager.random, b); err != nil {
+        log.Errorf("generate session nonce failed: %v", err)
+        return
+    }
+    // unpadded, so the cookie value needs no escaping
+    nonce := base64.RawURLEncoding.EncodeToString(b)
+    session.Set(keyNonce, nonce)
+    cookie := manager.sessionCookie(r, nonce, manager.cookieLifetime(session, r))
+    cookie.Name = manager.nonceCookieName()
+    manager.writeCookie(w, r, cookie)
+}
+
+// compare the nonce sent with r to the one stored in session and roll it on
+// a match. false means the nonce is outdated, caller must hold the lock
+func (manager *Manager) checkNonce(w http.ResponseWriter, r *http.Request, session Session) bool {
+    stored, ok := session.Get(keyNonce).(string)
+    if ok {
+        cookie, err := r.Cookie(manager.nonceCookieName())
+        if err != nil {
+            return false
+        }
+        sent, err := url.QueryUnescape(cookie.Value)
+        if err != nil || subtle.ConstantTimeCompare([]byte(sent), []byte(stored)) != 1 {
+            return false
+        }
+    }
+    manager.issueNonce(w, r, session)
+    return true
+}
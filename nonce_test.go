@@ -0,0 +1,73 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+)
+
+// start the session of the cookies, return it with the cookies of the response
+func resume(manager *Manager, cookies ...*http.Cookie) (Session, *http.Cookie, *http.Cookie) {
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, requestWith(cookies...))
+    return s, responseCookie(rec, manager.cookieNameInUse()), responseCookie(rec, manager.nonceCookieName())
+}
+
+func TestRollingNonce(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetRollingNonce(true)
+    s, c, nonce := resume(manager)
+    if nonce == nil || nonce.Value != s.Get(keyNonce) {
+        t.Fatalf("nonce cookie = %v, want the stored nonce", nonce)
+    }
+    // the cookie value is sent as is, escaping it would break the comparison
+    if strings.ContainsAny(nonce.Value, "=%") || url.QueryEscape(nonce.Value) != nonce.Value {
+        t.Fatalf("nonce %q needs escaping", nonce.Value)
+    }
+
+    got, _, next := resume(manager, c, nonce)
+    if got.SessionID() != s.SessionID() {
+        t.Fatal("session with the current nonce was replaced")
+    }
+    if next == nil || next.Value == nonce.Value {
+        t.Fatalf("nonce not rolled: %v", next)
+    }
+
+    // a client escaping the cookie value still matches
+    escaped := &http.Cookie{Name: next.Name, Value: strings.Replace(url.QueryEscape(next.Value), "-", "%2D", -1)}
+    if got, _, _ := resume(manager, c, escaped); got.SessionID() != s.SessionID() {
+        t.Fatal("escaped nonce was rejected")
+    }
+}
+
+// a copy of the cookies used after the owner moved on presents an outdated
+// nonce and loses the session
+func TestRollingNonceDetectsClone(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetRollingNonce(true)
+    s, c, stolen := resume(manager)
+
+    if got, _, _ := resume(manager, c, stolen); got.SessionID() != s.SessionID() {
+        t.Fatal("owner lost the session")
+    }
+    logged := captureLog(t)
+    got, replaced, _ := resume(manager, c, stolen)
+    if got.SessionID() == s.SessionID() {
+        t.Fatal("replayed nonce kept the session")
+    }
+    if out := logged.String(); strings.Contains(out, s.SessionID()) || !strings.Contains(out, "WARN session "+manager.redactSID(s.SessionID())+" presented an outdated nonce") {
+        t.Fatalf("clone warning shows the sid or is missing:\n%s", out)
+    }
+    if p.stored(s.SessionID()) != nil {
+        t.Fatal("cloned session was not destroyed")
+    }
+    if replaced == nil || replaced.Value != url.QueryEscape(got.SessionID()) {
+        t.Fatalf("cookie after the clone = %v, want the replacing session", replaced)
+    }
+
+    if again, _, _ := resume(manager, replaced); again.SessionID() == got.SessionID() {
+        t.Fatal("session cookie without nonce accepted")
+    }
+}
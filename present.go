@@ -0,0 +1,27 @@
+package session
+
+// implemented by sessions which can delete a key and tell whether it was
+// there in one step
+type presentDeleter interface {
+    DeleteIfPresent(key interface{}) (bool, error)
+}
+
+// DeleteIfPresent delete key from s and report whether it held a value.
+// without support from the session, presence is taken from Snapshot or,
+// when s isn't a Snapshotter, from Get returning non-nil
+func (manager *Manager) DeleteIfPresent(s Session, key interface{}) (bool, error) {
+    s = unwrapSession(s)
+    if d, ok := s.(presentDeleter); ok {
+        return d.DeleteIfPresent(key)
+    }
+    var present bool
+    if snap, ok := s.(Snapshotter); ok {
+        _, present = snap.Snapshot()[key]
+    } else {
+        present = s.Get(key) != nil
+    }
+    if !present {
+        return false, nil
+    }
+    return true, s.Delete(key)
+}
@@ -0,0 +1,36 @@
+package session
+
+import "testing"
+
+func TestDeleteIfPresent(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, _ := startNew(t, manager)
+    // a nil value is present for a Snapshotter
+    s.Set("user", "alice")
+    s.Set("empty", nil)
+    plain := struct{ Session }{s}
+
+    for _, tc := range []struct {
+        s    Session
+        key  string
+        want bool
+    }{
+        {s, "user", true},
+        {s, "user", false},
+        {s, "empty", true},
+        {s, "missing", false},
+    } {
+        got, err := manager.DeleteIfPresent(tc.s, tc.key)
+        if err != nil || got != tc.want {
+            t.Errorf("DeleteIfPresent(%q) = %v, %v, want %v", tc.key, got, err, tc.want)
+        }
+    }
+
+    s.Set("user", "alice")
+    if got, err := manager.DeleteIfPresent(plain, "user"); err != nil || !got || s.Get("user") != nil {
+        t.Fatalf("DeleteIfPresent on a session without Snapshot = %v, %v", got, err)
+    }
+    if got, _ := manager.DeleteIfPresent(plain, "user"); got {
+        t.Fatal("DeleteIfPresent on a session without Snapshot found a deleted key")
+    }
+}
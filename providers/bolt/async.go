@@ -0,0 +1,162 @@
+package bolt
+
+import (
+    "errors"
+    "github.com/jimmyzhouj/session"
+    log "github.com/cihub/seelog"
+    bbolt "go.etcd.io/bbolt"
+    "sync"
+)
+
+// returned by writes queued after Close
+var errClosed = errors.New("bolt: provider closed")
+
+// test hook run by the worker before each queued write, taken by SetAsyncWrites
+var beforeAsyncWrite func()
+
+// a session record waiting to be written by the background worker
+type writeJob struct {
+    sid     string
+    record  []byte
+    version uint64
+}
+
+// state of asynchronous writes, guarded by Provider.lock
+type asyncWriter struct {
+    queue      chan writeJob
+    syncOnFull bool
+    version    uint64              //increased for every queued record
+    pending    map[string]writeJob //latest record not yet written, per sid
+    inflight   sync.WaitGroup      //queued jobs not yet handled
+    sending    sync.WaitGroup      //enqueue calls that may still send on queue
+    closed     bool                //set by stopAsync, no more sends after it
+    done       chan struct{}       //closed when the worker exits
+    hook       func()              //beforeAsyncWrite at the time of SetAsyncWrites
+}
+
+// SetAsyncWrites make Set, Delete and Rename return before the session is
+// written: records go through a queue of queueSize to a background worker.
+// when the queue is full the write is done synchronously if syncOnFull,
+// otherwise the caller waits for room. reads see queued records.
+// call once, before the provider is used. Flush and Close drain the queue
+func (pder *Provider) SetAsyncWrites(queueSize int, syncOnFull bool) {
+    a := &asyncWriter{
+        queue:      make(chan writeJob, queueSize),
+        syncOnFull: syncOnFull,
+        pending:    make(map[string]writeJob),
+        done:       make(chan struct{}),
+        hook:       beforeAsyncWrite,
+    }
+    pder.lock.Lock()
+    pder.async = a
+    pder.lock.Unlock()
+    go pder.writeLoop(a)
+}
+
+// the async state, nil if writes are synchronous
+func (pder *Provider) asyncWriter() *asyncWriter {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    return pder.async
+}
+
+// Flush wait until every queued write is done
+func (pder *Provider) Flush() {
+    if a := pder.asyncWriter(); a != nil {
+        a.inflight.Wait()
+    }
+}
+
+func (pder *Provider) writeLoop(a *asyncWriter) {
+    defer close(a.done)
+    for job := range a.queue {
+        if a.hook != nil {
+            a.hook()
+        }
+        if err := pder.writeJob(job); err != nil {
+            log.Errorf("bolt: write session %s failed: %v", session.RedactKey(job.sid), err)
+        }
+        a.inflight.Done()
+    }
+}
+
+// queue record for sid, or write it right away when the queue is full and
+// syncOnFull. fails with errClosed once Close stopped the worker
+func (pder *Provider) enqueue(a *asyncWriter, sid string, record []byte) error {
+    pder.lock.Lock()
+    if a.closed {
+        pder.lock.Unlock()
+        return errClosed
+    }
+    a.version++
+    job := writeJob{sid: sid, record: record, version: a.version}
+    a.pending[sid] = job
+    a.inflight.Add(1)
+    a.sending.Add(1)
+    pder.lock.Unlock()
+    defer a.sending.Done()
+
+    select {
+    case a.queue <- job:
+        return nil
+    default:
+    }
+    if !a.syncOnFull {
+        a.queue <- job
+        return nil
+    }
+    defer a.inflight.Done()
+    return pder.writeJob(job)
+}
+
+// write job unless a newer record for the sid was queued or the session destroyed since
+func (pder *Provider) writeJob(job writeJob) error {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    if cur, ok := pder.async.pending[job.sid]; !ok || cur.version != job.version {
+        return nil
+    }
+    err := pder.db.Update(func(tx *bbolt.Tx) error {
+        return tx.Bucket(bucketName).Put([]byte(job.sid), job.record)
+    })
+    if err == nil {
+        delete(pder.async.pending, job.sid)
+    }
+    return err
+}
+
+// queued record of sid, nil if none
+func (pder *Provider) pendingRecord(sid string) []byte {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    if pder.async == nil {
+        return nil
+    }
+    if job, ok := pder.async.pending[sid]; ok {
+        return job.record
+    }
+    return nil
+}
+
+// drop the queued record of sid, caller must hold pder.lock
+func (pder *Provider) dropPending(sid string) {
+    if pder.async != nil {
+        delete(pder.async.pending, sid)
+    }
+}
+
+// stop the worker after it wrote everything queued. enqueue calls already
+// past the closed check finish their send first, the worker keeps draining
+func (pder *Provider) stopAsync() {
+    pder.lock.Lock()
+    a := pder.async
+    if a == nil || a.closed {
+        pder.lock.Unlock()
+        return
+    }
+    a.closed = true
+    pder.lock.Unlock()
+    a.sending.Wait()
+    close(a.queue)
+    <-a.done
+}
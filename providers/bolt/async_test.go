@@ -0,0 +1,134 @@
+package bolt
+
+import (
+    "fmt"
+    "sync"
+    "testing"
+    bbolt "go.etcd.io/bbolt"
+)
+
+// record of sid in the database, ignoring queued writes
+func stored(t *testing.T, pder *Provider, sid string) []byte {
+    t.Helper()
+    var record []byte
+    pder.db.View(func(tx *bbolt.Tx) error {
+        // the slice is only valid in the transaction
+        record = append([]byte(nil), tx.Bucket(bucketName).Get([]byte(sid))...)
+        return nil
+    })
+    return record
+}
+
+func TestAsyncWritesFlush(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    pder.SetAsyncWrites(16, false)
+    sess, _ := pder.SessionInit("sid1")
+    for i := 0; i < 10; i++ {
+        if err := sess.Set("n", i); err != nil {
+            t.Fatalf("Set: %v", err)
+        }
+    }
+    if read, _ := pder.SessionRead("sid1"); read.Get("n") != 9 {
+        t.Fatalf("read before Flush = %v, want the queued 9", read.Get("n"))
+    }
+
+    pder.Flush()
+    if len(pder.async.pending) != 0 {
+        t.Fatalf("%d records still pending after Flush", len(pder.async.pending))
+    }
+    values, err := pder.decode("sid1", stored(t, pder, "sid1")[8:])
+    if err != nil || values["n"] != 9 {
+        t.Fatalf("stored after Flush = %v, %v, want 9", values, err)
+    }
+}
+
+func TestAsyncSyncOnFull(t *testing.T) {
+    // hold the worker in its first write, so the queue can be filled
+    started, release := make(chan struct{}), make(chan struct{})
+    var once sync.Once
+    beforeAsyncWrite = func() {
+        once.Do(func() {
+            close(started)
+            <-release
+        })
+    }
+    defer func() { beforeAsyncWrite = nil }()
+    pder, _ := newTestProvider(t)
+    pder.SetAsyncWrites(1, true)
+    defer close(release)
+
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("n", 1)
+    <-started
+    sess.Set("n", 2)
+    if err := sess.Set("n", 3); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+    // no room in the queue, so the write was done before Set returned
+    values, err := pder.decode("sid1", stored(t, pder, "sid1")[8:])
+    if err != nil || values["n"] != 3 {
+        t.Fatalf("stored = %v, %v, want the synchronous write of 3", values, err)
+    }
+}
+
+func TestAsyncDestroyDropsQueued(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    pder.SetAsyncWrites(16, false)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("n", 1)
+    pder.SessionDestroy("sid1")
+    pder.Flush()
+    if stored(t, pder, "sid1") != nil {
+        t.Fatal("queued write resurrected a destroyed session")
+    }
+}
+
+// run with -race: writers racing Close must neither panic nor lose a
+// write they were told succeeded
+func TestAsyncWriteAfterClose(t *testing.T) {
+    pder, path := newTestProvider(t)
+    pder.SetAsyncWrites(1, false)
+    sessions := make([]*SessionStore, 8)
+    for i := range sessions {
+        s, _ := pder.SessionInit(fmt.Sprintf("sid%d", i))
+        sessions[i] = s.(*SessionStore)
+    }
+
+    var wg sync.WaitGroup
+    var lock sync.Mutex
+    written := make(map[string]int)
+    for _, s := range sessions {
+        wg.Add(1)
+        go func(s *SessionStore) {
+            defer wg.Done()
+            for i := 0; ; i++ {
+                if err := s.Set("n", i); err != nil {
+                    if err != errClosed {
+                        t.Errorf("Set: %v", err)
+                    }
+                    return
+                }
+                lock.Lock()
+                written[s.sid] = i
+                lock.Unlock()
+            }
+        }(s)
+    }
+    pder.Close()
+    wg.Wait()
+
+    reopened, err := NewProvider(path, nil)
+    if err != nil {
+        t.Fatalf("reopen: %v", err)
+    }
+    defer reopened.Close()
+    for sid, n := range written {
+        values, err := reopened.load(sid)
+        if err != nil || values["n"] != n {
+            t.Errorf("%s stored %v, %v, want the last accepted write %d", sid, values, err, n)
+        }
+    }
+    if err := sessions[0].Set("n", -1); err != errClosed {
+        t.Fatalf("Set after Close = %v, want errClosed", err)
+    }
+}
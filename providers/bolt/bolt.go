@@ -0,0 +1,486 @@
+package bolt
+
+import (
+    "encoding/base64"
+    "encoding/binary"
+    "errors"
+    log "github.com/cihub/seelog"
+    "github.com/jimmyzhouj/session"
+    bbolt "go.etcd.io/bbolt"
+    "sync"
+    "time"
+)
+
+var bucketName = []byte("sessions")
+
+// lifetimes set with SetLifetime, seconds (8 bytes big endian) per session id
+var lifetimeBucket = []byte("lifetimes")
+
+type SessionStore struct {
+    sid       string                      //session id
+    value     map[interface{}]interface{} //session values
+    modified  map[interface{}]time.Time   //modification times, not persisted
+    transient map[interface{}]interface{} //values set with SetTransient, not persisted
+    pder      *Provider
+}
+
+func (st *SessionStore) SetTransient(key, value interface{}) {
+    if st.transient == nil {
+        st.transient = make(map[interface{}]interface{})
+    }
+    st.transient[key] = value
+}
+
+func (st *SessionStore) Set(key, value interface{}) error {
+    delete(st.transient, key)
+    st.value[key] = value
+    st.modified[key] = time.Now()
+    return st.pder.save(st.sid, st.value)
+}
+
+func (st *SessionStore) Get(key interface{}) interface{} {
+    if v, ok := st.transient[key]; ok {
+        return v
+    }
+    if v, ok := st.value[key]; ok {
+        return v
+    }
+    return nil
+}
+
+func (st *SessionStore) Delete(key interface{}) error {
+    delete(st.transient, key)
+    delete(st.value, key)
+    delete(st.modified, key)
+    return st.pder.save(st.sid, st.value)
+}
+
+func (st *SessionStore) Rename(oldKey, newKey interface{}) error {
+    v, ok := st.value[oldKey]
+    if !ok {
+        return nil
+    }
+    delete(st.value, oldKey)
+    delete(st.modified, oldKey)
+    st.value[newKey] = v
+    st.modified[newKey] = time.Now()
+    return st.pder.save(st.sid, st.value)
+}
+
+// KeyModifiedAt only know about changes made since the session was read,
+// modification times are not stored in the database
+func (st *SessionStore) KeyModifiedAt(key interface{}) (time.Time, bool) {
+    t, ok := st.modified[key]
+    return t, ok
+}
+
+func (st *SessionStore) Snapshot() map[interface{}]interface{} {
+    values := make(map[interface{}]interface{}, len(st.value))
+    for k, v := range st.value {
+        values[k] = v
+    }
+    return values
+}
+
+// Apply set and delete several values with one write
+func (st *SessionStore) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    now := time.Now()
+    for _, k := range deleted {
+        delete(st.transient, k)
+        delete(st.value, k)
+        delete(st.modified, k)
+    }
+    for k, v := range set {
+        delete(st.transient, k)
+        st.value[k] = v
+        st.modified[k] = now
+    }
+    return st.pder.save(st.sid, st.value)
+}
+
+func (st *SessionStore) Begin() (session.Session, func() error) {
+    return session.NewView(st)
+}
+
+func (st *SessionStore) SessionID() string {
+    return st.sid
+}
+
+// Provider keep sessions in a bolt database file, one key per session id.
+// the stored record is the last access time (unix seconds, 8 bytes big endian)
+// followed by the values encoded with codec
+type Provider struct {
+    db        *bbolt.DB
+    codec     session.Codec
+    lock      sync.Mutex
+    gcReports []func(collected int)
+    expires   []func(sid string, values map[interface{}]interface{})
+    async     *asyncWriter
+    enc       session.Encrypter
+    gcLimiter *session.RateLimiter
+}
+
+// open (or create) the bolt database at path, register the returned
+// provider with session.Register before use
+func NewProvider(path string, codec session.Codec) (*Provider, error) {
+    if codec == nil {
+        codec = session.GobCodec{}
+    }
+    db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+    if err != nil {
+        return nil, err
+    }
+    err = db.Update(func(tx *bbolt.Tx) error {
+        if _, err := tx.CreateBucketIfNotExists(bucketName); err != nil {
+            return err
+        }
+        _, err := tx.CreateBucketIfNotExists(lifetimeBucket)
+        return err
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &Provider{db: db, codec: codec}, nil
+}
+
+// close the underlying database, after queued writes are done
+func (pder *Provider) Close() error {
+    pder.stopAsync()
+    return pder.db.Close()
+}
+
+// SetEncrypter encrypt the encoded values of every session written from now on
+// with e, call before the provider is used. records written before can't be read
+func (pder *Provider) SetEncrypter(e session.Encrypter) {
+    pder.enc = e
+}
+
+// SetIntegrityCheck store a checksum with every session and verify it on
+// read, see session.ChecksumCodec. call before the provider is used
+func (pder *Provider) SetIntegrityCheck(check bool) {
+    if c, ok := pder.codec.(session.ChecksumCodec); ok {
+        if !check {
+            pder.codec = c.Codec
+        }
+        return
+    }
+    if check {
+        pder.codec = session.ChecksumCodec{Codec: pder.codec}
+    }
+}
+
+func (pder *Provider) record(sid string, values map[interface{}]interface{}) ([]byte, error) {
+    data, err := pder.codec.Encode(values)
+    if err != nil {
+        return nil, err
+    }
+    if pder.enc != nil {
+        if data, err = pder.enc.Encrypt(sid, data); err != nil {
+            return nil, err
+        }
+    }
+    record := make([]byte, 8+len(data))
+    binary.BigEndian.PutUint64(record, uint64(time.Now().Unix()))
+    copy(record[8:], data)
+    return record, nil
+}
+
+// values of the record payload stored for sid
+func (pder *Provider) decode(sid string, payload []byte) (map[interface{}]interface{}, error) {
+    if pder.enc != nil {
+        var err error
+        if payload, err = pder.enc.Decrypt(sid, payload); err != nil {
+            return nil, err
+        }
+    }
+    return pder.codec.Decode(payload)
+}
+
+func (pder *Provider) save(sid string, values map[interface{}]interface{}) error {
+    record, err := pder.record(sid, values)
+    if err != nil {
+        return err
+    }
+    if a := pder.asyncWriter(); a != nil {
+        return pder.enqueue(a, sid, record)
+    }
+    return pder.db.Update(func(tx *bbolt.Tx) error {
+        return tx.Bucket(bucketName).Put([]byte(sid), record)
+    })
+}
+
+func (pder *Provider) SessionInit(sid string) (session.Session, error) {
+    newsess := &SessionStore{sid: sid, value: make(map[interface{}]interface{}), modified: make(map[interface{}]time.Time), pder: pder}
+    record, err := pder.record(sid, newsess.value)
+    if err != nil {
+        return nil, err
+    }
+    err = pder.db.Update(func(tx *bbolt.Tx) error {
+        b := tx.Bucket(bucketName)
+        if b.Get([]byte(sid)) != nil {
+            return session.ErrSIDCollision
+        }
+        return b.Put([]byte(sid), record)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return newsess, nil
+}
+
+// values stored for sid, nil if there is no such session
+func (pder *Provider) load(sid string) (map[interface{}]interface{}, error) {
+    record := pder.pendingRecord(sid)
+    if record == nil {
+        err := pder.db.View(func(tx *bbolt.Tx) error {
+            if v := tx.Bucket(bucketName).Get([]byte(sid)); v != nil {
+                record = append([]byte(nil), v...)
+            }
+            return nil
+        })
+        if err != nil {
+            return nil, err
+        }
+    }
+    if record == nil {
+        return nil, nil
+    }
+    if len(record) < 8 {
+        return nil, errors.New("bolt: corrupt session record for " + sid)
+    }
+    return pder.decode(sid, record[8:])
+}
+
+func (pder *Provider) SessionRead(sid string) (session.Session, error) {
+    values, err := pder.load(sid)
+    if err != nil {
+        return nil, err
+    }
+    if values == nil {
+        sess, err := pder.SessionInit(sid)
+        if err == session.ErrSIDCollision {
+            // created by someone else meanwhile
+            return pder.SessionRead(sid)
+        }
+        return sess, err
+    }
+    // store again to refresh the access time
+    if err := pder.save(sid, values); err != nil {
+        return nil, err
+    }
+    return &SessionStore{sid: sid, value: values, modified: make(map[interface{}]time.Time), pder: pder}, nil
+}
+
+// WriteDiff apply the changed and deleted keys to the stored session in one write
+func (pder *Provider) WriteDiff(sid string, set map[interface{}]interface{}, deleted []interface{}) error {
+    values, err := pder.load(sid)
+    if err != nil {
+        return err
+    }
+    if values == nil {
+        values = make(map[interface{}]interface{})
+    }
+    for _, k := range deleted {
+        delete(values, k)
+    }
+    for k, v := range set {
+        values[k] = v
+    }
+    return pder.save(sid, values)
+}
+
+func (pder *Provider) SessionDestroy(sid string) error {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.dropPending(sid)
+    return pder.db.Update(func(tx *bbolt.Tx) error {
+        if err := tx.Bucket(lifetimeBucket).Delete([]byte(sid)); err != nil {
+            return err
+        }
+        return tx.Bucket(bucketName).Delete([]byte(sid))
+    })
+}
+
+// SetLifetime let sid expire after lifetime seconds of inactivity instead of
+// the maxlifetime given to SessionGC, lifetime <= 0 restores that
+func (pder *Provider) SetLifetime(sid string, lifetime int64) error {
+    return pder.db.Update(func(tx *bbolt.Tx) error {
+        b := tx.Bucket(lifetimeBucket)
+        if lifetime <= 0 {
+            return b.Delete([]byte(sid))
+        }
+        if tx.Bucket(bucketName).Get([]byte(sid)) == nil {
+            return nil
+        }
+        v := make([]byte, 8)
+        binary.BigEndian.PutUint64(v, uint64(lifetime))
+        return b.Put([]byte(sid), v)
+    })
+}
+
+// report whether record of session k was last accessed more than its
+// lifetime, or maxlifetime if it has none, before now
+func isExpired(tx *bbolt.Tx, k, record []byte, now, maxlifetime int64) bool {
+    if len(record) < 8 {
+        return true
+    }
+    lifetime := maxlifetime
+    if v := tx.Bucket(lifetimeBucket).Get(k); len(v) == 8 {
+        lifetime = int64(binary.BigEndian.Uint64(v))
+    }
+    return int64(binary.BigEndian.Uint64(record)) < now-lifetime
+}
+
+// delete session k and its lifetime
+func deleteSession(tx *bbolt.Tx, k []byte) error {
+    if err := tx.Bucket(lifetimeBucket).Delete(k); err != nil {
+        return err
+    }
+    return tx.Bucket(bucketName).Delete(k)
+}
+
+// keys and records of expired sessions
+func expiredIn(tx *bbolt.Tx, now, maxlifetime int64) (expired, records [][]byte) {
+    tx.Bucket(bucketName).ForEach(func(k, v []byte) error {
+        if isExpired(tx, k, v, now, maxlifetime) {
+            expired = append(expired, append([]byte(nil), k...))
+            records = append(records, append([]byte(nil), v...))
+        }
+        return nil
+    })
+    return expired, records
+}
+
+func (pder *Provider) SessionGC(maxlifetime int64) {
+    now := time.Now().Unix()
+    pder.lock.Lock()
+    limiter := pder.gcLimiter
+    pder.lock.Unlock()
+
+    var expired, records [][]byte
+    if limiter != nil {
+        expired, records = pder.pacedGC(now, maxlifetime, limiter)
+    } else {
+        err := pder.db.Update(func(tx *bbolt.Tx) error {
+            expired, records = expiredIn(tx, now, maxlifetime)
+            for _, k := range expired {
+                if err := deleteSession(tx, k); err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        if err != nil {
+            return
+        }
+    }
+
+    pder.lock.Lock()
+    reports, expires := pder.gcReports, pder.expires
+    pder.lock.Unlock()
+    if len(expires) > 0 {
+        for i, k := range expired {
+            var values map[interface{}]interface{}
+            if len(records[i]) >= 8 {
+                values, _ = pder.decode(string(k), records[i][8:])
+            }
+            for _, notify := range expires {
+                notify(string(k), values)
+            }
+        }
+    }
+    for _, report := range reports {
+        report(len(expired))
+    }
+}
+
+// delete expired sessions one transaction each, at the pace of limiter.
+// sessions accessed since the scan are kept. on failure the sessions deleted
+// so far are returned
+func (pder *Provider) pacedGC(now, maxlifetime int64, limiter *session.RateLimiter) (expired, records [][]byte) {
+    var candidates [][]byte
+    pder.db.View(func(tx *bbolt.Tx) error {
+        candidates, _ = expiredIn(tx, now, maxlifetime)
+        return nil
+    })
+    for _, k := range candidates {
+        limiter.Wait()
+        var record []byte
+        err := pder.db.Update(func(tx *bbolt.Tx) error {
+            v := tx.Bucket(bucketName).Get(k)
+            if v == nil || !isExpired(tx, k, v, now, maxlifetime) {
+                return nil
+            }
+            record = append([]byte(nil), v...)
+            return deleteSession(tx, k)
+        })
+        if err != nil {
+            log.Errorf("bolt: gc of session %s failed: %v", session.RedactKey(string(k)), err)
+            break
+        }
+        if record != nil {
+            expired = append(expired, k)
+            records = append(records, record)
+        }
+    }
+    return expired, records
+}
+
+// SetGCRateLimit limit SessionGC to opsPerSec deletions per second, each in
+// its own transaction. opsPerSec <= 0 removes the limit
+func (pder *Provider) SetGCRateLimit(opsPerSec int) {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.gcLimiter = session.NewRateLimiter(opsPerSec)
+}
+
+// ListSessions page through the sids in key order, the cursor is the
+// last sid of the previous page, base64 encoded. limit <= 0 means
+// session.DefaultListLimit
+func (pder *Provider) ListSessions(cursor string, limit int) ([]string, string, error) {
+    if limit <= 0 {
+        limit = session.DefaultListLimit
+    }
+    after, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return nil, "", errors.New("bolt: invalid cursor")
+    }
+    var sids []string
+    more := false
+    err = pder.db.View(func(tx *bbolt.Tx) error {
+        c := tx.Bucket(bucketName).Cursor()
+        var k []byte
+        if cursor == "" {
+            k, _ = c.First()
+        } else if k, _ = c.Seek(after); k != nil && string(k) == string(after) {
+            k, _ = c.Next()
+        }
+        for ; k != nil; k, _ = c.Next() {
+            if len(sids) == limit {
+                more = true
+                break
+            }
+            sids = append(sids, string(k))
+        }
+        return nil
+    })
+    if err != nil || !more {
+        return sids, "", err
+    }
+    return sids, base64.RawURLEncoding.EncodeToString([]byte(sids[limit-1])), nil
+}
+
+// OnExpire register a callback told about every session SessionGC removed
+func (pder *Provider) OnExpire(notify func(sid string, values map[interface{}]interface{})) {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.expires = append(pder.expires, notify)
+}
+
+// OnGC register a callback told how many sessions each SessionGC removed
+func (pder *Provider) OnGC(report func(collected int)) {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.gcReports = append(pder.gcReports, report)
+}
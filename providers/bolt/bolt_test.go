@@ -0,0 +1,326 @@
+package bolt
+
+import (
+    "bytes"
+    "encoding/binary"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/jimmyzhouj/session"
+    bbolt "go.etcd.io/bbolt"
+)
+
+// provider on a database in a fresh temporary directory
+func newTestProvider(t *testing.T) (*Provider, string) {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "sessions.db")
+    pder, err := NewProvider(path, nil)
+    if err != nil {
+        t.Fatalf("NewProvider: %v", err)
+    }
+    t.Cleanup(func() { pder.Close() })
+    return pder, path
+}
+
+// move the access time stored for sid seconds into the past
+func age(t *testing.T, pder *Provider, sid string, seconds int64) {
+    t.Helper()
+    err := pder.db.Update(func(tx *bbolt.Tx) error {
+        b := tx.Bucket(bucketName)
+        record := append([]byte(nil), b.Get([]byte(sid))...)
+        accessed := int64(binary.BigEndian.Uint64(record))
+        binary.BigEndian.PutUint64(record, uint64(accessed-seconds))
+        return b.Put([]byte(sid), record)
+    })
+    if err != nil {
+        t.Fatalf("age %s: %v", sid, err)
+    }
+}
+
+func TestValuesSurviveReopen(t *testing.T) {
+    pder, path := newTestProvider(t)
+    sess, err := pder.SessionInit("sid1")
+    if err != nil {
+        t.Fatalf("SessionInit: %v", err)
+    }
+    if err := sess.Set("user", "alice"); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+    if err := pder.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+
+    reopened, err := NewProvider(path, nil)
+    if err != nil {
+        t.Fatalf("reopen: %v", err)
+    }
+    defer reopened.Close()
+    read, err := reopened.SessionRead("sid1")
+    if err != nil {
+        t.Fatalf("SessionRead: %v", err)
+    }
+    if got := read.Get("user"); got != "alice" {
+        t.Fatalf("user after reopen = %v, want alice", got)
+    }
+}
+
+func TestSessionDestroy(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("user", "alice")
+    if err := pder.SessionDestroy("sid1"); err != nil {
+        t.Fatalf("SessionDestroy: %v", err)
+    }
+    read, err := pder.SessionRead("sid1")
+    if err != nil {
+        t.Fatalf("SessionRead: %v", err)
+    }
+    if got := read.Get("user"); got != nil {
+        t.Fatalf("user after destroy = %v, want a fresh session", got)
+    }
+}
+
+func TestSessionGC(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    for _, sid := range []string{"old", "fresh"} {
+        if _, err := pder.SessionInit(sid); err != nil {
+            t.Fatalf("SessionInit %s: %v", sid, err)
+        }
+    }
+    age(t, pder, "old", 120)
+
+    pder.SessionGC(60)
+    values, err := pder.load("old")
+    if err != nil || values != nil {
+        t.Fatalf("old session after GC = %v, %v, want it removed", values, err)
+    }
+    if values, err := pder.load("fresh"); err != nil || values == nil {
+        t.Fatalf("fresh session after GC = %v, %v, want it kept", values, err)
+    }
+}
+
+func TestSessionReadRefreshesAccessTime(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    pder.SessionInit("sid1")
+    age(t, pder, "sid1", 120)
+    if _, err := pder.SessionRead("sid1"); err != nil {
+        t.Fatalf("SessionRead: %v", err)
+    }
+    pder.SessionGC(60)
+    if values, _ := pder.load("sid1"); values == nil {
+        t.Fatal("session read within maxlifetime was collected")
+    }
+}
+
+func TestRename(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("old", "v")
+    if err := sess.Rename("old", "new"); err != nil {
+        t.Fatalf("Rename: %v", err)
+    }
+    read, err := pder.SessionRead("sid1")
+    if err != nil {
+        t.Fatalf("SessionRead: %v", err)
+    }
+    if read.Get("old") != nil || read.Get("new") != "v" {
+        t.Fatalf("stored values after Rename = %v, want only new", read.(*SessionStore).Snapshot())
+    }
+    if err := sess.Rename("missing", "other"); err != nil {
+        t.Fatalf("Rename of a missing key: %v", err)
+    }
+    if read, _ := pder.SessionRead("sid1"); read.Get("other") != nil {
+        t.Fatal("Rename of a missing key stored a value")
+    }
+
+    // an existing destination is overwritten
+    sess.Set("taken", "old value")
+    if err := sess.Rename("new", "taken"); err != nil {
+        t.Fatalf("Rename onto an existing key: %v", err)
+    }
+    read, _ = pder.SessionRead("sid1")
+    if read.Get("taken") != "v" || read.Get("new") != nil {
+        t.Fatalf("stored values after Rename onto an existing key = %v, want taken overwritten", read.(*SessionStore).Snapshot())
+    }
+}
+
+func TestSessionInitCollision(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("user", "alice")
+    if _, err := pder.SessionInit("sid1"); err != session.ErrSIDCollision {
+        t.Fatalf("second SessionInit = %v, want ErrSIDCollision", err)
+    }
+    if read, _ := pder.SessionRead("sid1"); read.Get("user") != "alice" {
+        t.Fatal("colliding SessionInit overwrote the session")
+    }
+}
+
+// modification times are not persisted, only changes since the read are known
+func TestKeyModifiedAt(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    before := time.Now()
+    sess.Set("a", 1)
+    if at, ok := sess.KeyModifiedAt("a"); !ok || at.Before(before) {
+        t.Fatalf("a modified at %v, %v, want the time of Set", at, ok)
+    }
+    read, _ := pder.SessionRead("sid1")
+    if _, ok := read.KeyModifiedAt("a"); ok {
+        t.Fatal("modification time reported for a key set before the read")
+    }
+}
+
+func TestWriteDiff(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("keep", "v")
+    sess.Set("drop", "v")
+
+    set := map[interface{}]interface{}{"user": "alice"}
+    if err := pder.WriteDiff("sid1", set, []interface{}{"drop"}); err != nil {
+        t.Fatalf("WriteDiff: %v", err)
+    }
+    values, err := pder.load("sid1")
+    if err != nil {
+        t.Fatalf("load: %v", err)
+    }
+    if len(values) != 2 || values["keep"] != "v" || values["user"] != "alice" {
+        t.Fatalf("stored values = %v, want keep and user", values)
+    }
+}
+
+func TestSetTransient(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    sess.SetTransient("request", "r1")
+    sess.Set("user", "alice")
+    if got := sess.Get("request"); got != "r1" {
+        t.Fatalf("transient value = %v, want r1", got)
+    }
+    values, err := pder.load("sid1")
+    if err != nil {
+        t.Fatalf("load: %v", err)
+    }
+    if _, ok := values["request"]; ok || values["user"] != "alice" {
+        t.Fatalf("stored values = %v, want the transient one left out", values)
+    }
+}
+
+func TestSetEncrypter(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    enc, err := session.NewPerSessionEncrypter([]byte("0123456789abcdef0123456789abcdef"))
+    if err != nil {
+        t.Fatalf("NewPerSessionEncrypter: %v", err)
+    }
+    pder.SetEncrypter(enc)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("user", "alice")
+
+    var raw []byte
+    pder.db.View(func(tx *bbolt.Tx) error {
+        raw = append(raw, tx.Bucket(bucketName).Get([]byte("sid1"))...)
+        return nil
+    })
+    if bytes.Contains(raw, []byte("alice")) {
+        t.Fatal("stored record contains the plain value")
+    }
+    if read, err := pder.SessionRead("sid1"); err != nil || read.Get("user") != "alice" {
+        t.Fatalf("SessionRead = %v, %v, want the decrypted session", read, err)
+    }
+}
+
+func TestSessionGCRateLimit(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    for i := 0; i < 12; i++ {
+        sid := string(rune('a' + i))
+        pder.SessionInit(sid)
+        age(t, pder, sid, 120)
+    }
+    pder.SessionInit("fresh")
+    pder.SetGCRateLimit(10)
+
+    start := time.Now()
+    pder.SessionGC(60)
+    if d := time.Since(start); d < 150*time.Millisecond {
+        t.Fatalf("GC of 12 sessions at 10 per second took %v, want it paced", d)
+    }
+    if values, _ := pder.load("a"); values != nil {
+        t.Fatal("paced GC left an expired session")
+    }
+    if values, _ := pder.load("fresh"); values == nil {
+        t.Fatal("paced GC removed a fresh session")
+    }
+}
+
+func TestSetLifetime(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    for _, sid := range []string{"short", "long", "reset"} {
+        pder.SessionInit(sid)
+    }
+    pder.SetLifetime("short", 30)
+    pder.SetLifetime("long", 7200)
+    pder.SetLifetime("reset", 30)
+    pder.SetLifetime("reset", 0)
+    age(t, pder, "short", 60)
+    age(t, pder, "long", 4000)
+    age(t, pder, "reset", 60)
+
+    pder.SessionGC(3600)
+    for sid, kept := range map[string]bool{"short": false, "long": true, "reset": true} {
+        if values, _ := pder.load(sid); (values != nil) != kept {
+            t.Errorf("session %s kept %v after GC, want %v", sid, values != nil, kept)
+        }
+    }
+}
+
+func TestSetIntegrityCheck(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    pder.SetIntegrityCheck(true)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("user", "alice")
+    if read, err := pder.SessionRead("sid1"); err != nil || read.Get("user") != "alice" {
+        t.Fatalf("SessionRead = %v, %v", read, err)
+    }
+
+    // flip a bit of the payload, after the access time
+    pder.db.Update(func(tx *bbolt.Tx) error {
+        b := tx.Bucket(bucketName)
+        record := append([]byte(nil), b.Get([]byte("sid1"))...)
+        record[9] ^= 1
+        return b.Put([]byte("sid1"), record)
+    })
+    if _, err := pder.SessionRead("sid1"); err != session.ErrCorrupt {
+        t.Fatalf("SessionRead of a corrupt record = %v, want ErrCorrupt", err)
+    }
+}
+
+func TestListSessions(t *testing.T) {
+    pder, _ := newTestProvider(t)
+    for _, sid := range []string{"e", "b", "a", "d", "c"} {
+        pder.SessionInit(sid)
+    }
+    var got []string
+    for cursor := ""; ; {
+        sids, next, err := pder.ListSessions(cursor, 2)
+        if err != nil {
+            t.Fatalf("ListSessions(%q): %v", cursor, err)
+        }
+        got = append(got, sids...)
+        if next == "" {
+            break
+        }
+        cursor = next
+    }
+    if strings.Join(got, ",") != "a,b,c,d,e" {
+        t.Fatalf("paged through %v, want every sid in order", got)
+    }
+
+    if sids, next, _ := pder.ListSessions("", 0); len(sids) != 5 || next != "" {
+        t.Fatalf("limit 0 = %v, %q, want one page with DefaultListLimit", sids, next)
+    }
+    if _, _, err := pder.ListSessions("not base64!", 2); err == nil {
+        t.Fatal("ListSessions accepted an invalid cursor")
+    }
+}
@@ -0,0 +1,259 @@
+package etcd
+
+import (
+    "context"
+    "github.com/jimmyzhouj/session"
+    clientv3 "go.etcd.io/etcd/client/v3"
+    "time"
+)
+
+// timeout of a single etcd request
+const requestTimeout = 5 * time.Second
+
+type SessionStore struct {
+    sid       string                      //session id
+    value     map[interface{}]interface{} //session values
+    modified  map[interface{}]time.Time   //modification times, not persisted
+    transient map[interface{}]interface{} //values set with SetTransient, not persisted
+    pder      *Provider
+}
+
+func (st *SessionStore) SetTransient(key, value interface{}) {
+    if st.transient == nil {
+        st.transient = make(map[interface{}]interface{})
+    }
+    st.transient[key] = value
+}
+
+func (st *SessionStore) Set(key, value interface{}) error {
+    delete(st.transient, key)
+    st.value[key] = value
+    st.modified[key] = time.Now()
+    return st.pder.save(st.sid, st.value)
+}
+
+func (st *SessionStore) Get(key interface{}) interface{} {
+    if v, ok := st.transient[key]; ok {
+        return v
+    }
+    if v, ok := st.value[key]; ok {
+        return v
+    }
+    return nil
+}
+
+func (st *SessionStore) Delete(key interface{}) error {
+    delete(st.transient, key)
+    delete(st.value, key)
+    delete(st.modified, key)
+    return st.pder.save(st.sid, st.value)
+}
+
+func (st *SessionStore) Rename(oldKey, newKey interface{}) error {
+    v, ok := st.value[oldKey]
+    if !ok {
+        return nil
+    }
+    delete(st.value, oldKey)
+    delete(st.modified, oldKey)
+    st.value[newKey] = v
+    st.modified[newKey] = time.Now()
+    return st.pder.save(st.sid, st.value)
+}
+
+// KeyModifiedAt only know about changes made since the session was read,
+// modification times are not stored in etcd
+func (st *SessionStore) KeyModifiedAt(key interface{}) (time.Time, bool) {
+    t, ok := st.modified[key]
+    return t, ok
+}
+
+func (st *SessionStore) Snapshot() map[interface{}]interface{} {
+    values := make(map[interface{}]interface{}, len(st.value))
+    for k, v := range st.value {
+        values[k] = v
+    }
+    return values
+}
+
+// Apply set and delete several values with one write
+func (st *SessionStore) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    now := time.Now()
+    for _, k := range deleted {
+        delete(st.transient, k)
+        delete(st.value, k)
+        delete(st.modified, k)
+    }
+    for k, v := range set {
+        delete(st.transient, k)
+        st.value[k] = v
+        st.modified[k] = now
+    }
+    return st.pder.save(st.sid, st.value)
+}
+
+func (st *SessionStore) Begin() (session.Session, func() error) {
+    return session.NewView(st)
+}
+
+func (st *SessionStore) SessionID() string {
+    return st.sid
+}
+
+// Provider keep sessions in etcd, one key per session id. every key is
+// attached to its own lease with a TTL of maxlifetime which SessionRead
+// renews, so etcd expires idle sessions and SessionGC has nothing to do
+type Provider struct {
+    client *clientv3.Client
+    codec  session.Codec
+    prefix string
+    ttl    int64
+}
+
+// connect to the etcd cluster at endpoints, register the returned provider
+// with session.Register before use. maxlifetime should match the manager's
+func NewProvider(endpoints []string, maxlifetime int64, codec session.Codec) (*Provider, error) {
+    if codec == nil {
+        codec = session.GobCodec{}
+    }
+    client, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: requestTimeout})
+    if err != nil {
+        return nil, err
+    }
+    return &Provider{client: client, codec: codec, prefix: "session/", ttl: maxlifetime}, nil
+}
+
+// close the connection to etcd
+func (pder *Provider) Close() error {
+    return pder.client.Close()
+}
+
+// SetIntegrityCheck store a checksum with every session and verify it on
+// read, see session.ChecksumCodec. call before the provider is used
+func (pder *Provider) SetIntegrityCheck(check bool) {
+    if c, ok := pder.codec.(session.ChecksumCodec); ok {
+        if !check {
+            pder.codec = c.Codec
+        }
+        return
+    }
+    if check {
+        pder.codec = session.ChecksumCodec{Codec: pder.codec}
+    }
+}
+
+func (pder *Provider) key(sid string) string {
+    return pder.prefix + sid
+}
+
+// store values under the existing key, which keeps its lease
+func (pder *Provider) save(sid string, values map[interface{}]interface{}) error {
+    data, err := pder.codec.Encode(values)
+    if err != nil {
+        return err
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+    defer cancel()
+    _, err = pder.client.Put(ctx, pder.key(sid), string(data), clientv3.WithIgnoreLease())
+    return err
+}
+
+func (pder *Provider) SessionInit(sid string) (session.Session, error) {
+    newsess := &SessionStore{sid: sid, value: make(map[interface{}]interface{}), modified: make(map[interface{}]time.Time), pder: pder}
+    data, err := pder.codec.Encode(newsess.value)
+    if err != nil {
+        return nil, err
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+    defer cancel()
+    grant, err := pder.client.Grant(ctx, pder.ttl)
+    if err != nil {
+        return nil, err
+    }
+    key := pder.key(sid)
+    resp, err := pder.client.Txn(ctx).
+        If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+        Then(clientv3.OpPut(key, string(data), clientv3.WithLease(grant.ID))).
+        Commit()
+    if err == nil && !resp.Succeeded {
+        err = session.ErrSIDCollision
+    }
+    if err != nil {
+        pder.client.Revoke(ctx, grant.ID)
+        return nil, err
+    }
+    return newsess, nil
+}
+
+func (pder *Provider) SessionRead(sid string) (session.Session, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+    defer cancel()
+    resp, err := pder.client.Get(ctx, pder.key(sid))
+    if err != nil {
+        return nil, err
+    }
+    if len(resp.Kvs) == 0 {
+        sess, err := pder.SessionInit(sid)
+        if err == session.ErrSIDCollision {
+            // created by someone else meanwhile
+            return pder.SessionRead(sid)
+        }
+        return sess, err
+    }
+    kv := resp.Kvs[0]
+    values, err := pder.codec.Decode(kv.Value)
+    if err != nil {
+        return nil, err
+    }
+    // renew the lease to restart the idle timeout
+    if _, err := pder.client.KeepAliveOnce(ctx, clientv3.LeaseID(kv.Lease)); err != nil {
+        return nil, err
+    }
+    return &SessionStore{sid: sid, value: values, modified: make(map[interface{}]time.Time), pder: pder}, nil
+}
+
+// SetLifetime move sid to a new lease with a TTL of lifetime seconds, which
+// SessionRead renews from then on. lifetime <= 0 restores maxlifetime
+func (pder *Provider) SetLifetime(sid string, lifetime int64) error {
+    if lifetime <= 0 {
+        lifetime = pder.ttl
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+    defer cancel()
+    resp, err := pder.client.Get(ctx, pder.key(sid))
+    if err != nil || len(resp.Kvs) == 0 {
+        return err
+    }
+    kv := resp.Kvs[0]
+    grant, err := pder.client.Grant(ctx, lifetime)
+    if err != nil {
+        return err
+    }
+    if _, err := pder.client.Put(ctx, pder.key(sid), string(kv.Value), clientv3.WithLease(grant.ID)); err != nil {
+        pder.client.Revoke(ctx, grant.ID)
+        return err
+    }
+    if old := clientv3.LeaseID(kv.Lease); old != clientv3.NoLease {
+        pder.client.Revoke(ctx, old)
+    }
+    return nil
+}
+
+// revoke the lease of sid, which deletes the key with it
+func (pder *Provider) SessionDestroy(sid string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+    defer cancel()
+    resp, err := pder.client.Get(ctx, pder.key(sid))
+    if err != nil || len(resp.Kvs) == 0 {
+        return err
+    }
+    if lease := clientv3.LeaseID(resp.Kvs[0].Lease); lease != clientv3.NoLease {
+        _, err = pder.client.Revoke(ctx, lease)
+        return err
+    }
+    _, err = pder.client.Delete(ctx, pder.key(sid))
+    return err
+}
+
+// etcd expires sessions through their leases
+func (pder *Provider) SessionGC(maxlifetime int64) {}
@@ -0,0 +1,114 @@
+//go:build integration
+
+package etcd
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+// run with a local etcd: go test -tags integration ./providers/etcd/
+// ETCD_ENDPOINTS overrides the endpoint, comma separated
+func newTestProvider(t *testing.T, maxlifetime int64) *Provider {
+    t.Helper()
+    endpoints := []string{"localhost:2379"}
+    if env := os.Getenv("ETCD_ENDPOINTS"); env != "" {
+        endpoints = strings.Split(env, ",")
+    }
+    pder, err := NewProvider(endpoints, maxlifetime, nil)
+    if err != nil {
+        t.Fatalf("connect to etcd at %v: %v", endpoints, err)
+    }
+    pder.prefix = fmt.Sprintf("session-test/%s/%d/", t.Name(), time.Now().UnixNano())
+    t.Cleanup(func() { pder.Close() })
+    return pder
+}
+
+func TestInitReadDestroy(t *testing.T) {
+    pder := newTestProvider(t, 60)
+    sess, err := pder.SessionInit("sid1")
+    if err != nil {
+        t.Fatalf("SessionInit: %v", err)
+    }
+    if err := sess.Set("user", "alice"); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+    if _, err := pder.SessionInit("sid1"); err == nil {
+        t.Fatal("second SessionInit of sid1 succeeded")
+    }
+
+    read, err := pder.SessionRead("sid1")
+    if err != nil {
+        t.Fatalf("SessionRead: %v", err)
+    }
+    if got := read.Get("user"); got != "alice" {
+        t.Fatalf("read user = %v, want alice", got)
+    }
+
+    if err := pder.SessionDestroy("sid1"); err != nil {
+        t.Fatalf("SessionDestroy: %v", err)
+    }
+    read, err = pder.SessionRead("sid1")
+    if err != nil {
+        t.Fatalf("SessionRead after destroy: %v", err)
+    }
+    if got := read.Get("user"); got != nil {
+        t.Fatalf("user after destroy = %v, want nil", got)
+    }
+}
+
+func TestLeaseExpiry(t *testing.T) {
+    pder := newTestProvider(t, 2)
+    sess, err := pder.SessionInit("sid1")
+    if err != nil {
+        t.Fatalf("SessionInit: %v", err)
+    }
+    if err := sess.Set("user", "alice"); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+
+    // a read renews the lease
+    time.Sleep(1500 * time.Millisecond)
+    if read, err := pder.SessionRead("sid1"); err != nil || read.Get("user") != "alice" {
+        t.Fatalf("SessionRead before expiry = %v, %v", read, err)
+    }
+    time.Sleep(1500 * time.Millisecond)
+    if read, err := pder.SessionRead("sid1"); err != nil || read.Get("user") != "alice" {
+        t.Fatalf("SessionRead within renewed lease = %v, %v", read, err)
+    }
+
+    time.Sleep(4 * time.Second)
+    read, err := pder.SessionRead("sid1")
+    if err != nil {
+        t.Fatalf("SessionRead after expiry: %v", err)
+    }
+    if got := read.Get("user"); got != nil {
+        t.Fatalf("user after lease expiry = %v, want nil", got)
+    }
+}
+
+func TestSetLifetime(t *testing.T) {
+    pder := newTestProvider(t, 60)
+    sess, err := pder.SessionInit("sid1")
+    if err != nil {
+        t.Fatalf("SessionInit: %v", err)
+    }
+    if err := sess.Set("user", "alice"); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+    if err := pder.SetLifetime("sid1", 2); err != nil {
+        t.Fatalf("SetLifetime: %v", err)
+    }
+
+    time.Sleep(4 * time.Second)
+    read, err := pder.SessionRead("sid1")
+    if err != nil {
+        t.Fatalf("SessionRead: %v", err)
+    }
+    if got := read.Get("user"); got != nil {
+        t.Fatalf("user after the shorter lifetime = %v, want nil", got)
+    }
+}
@@ -2,27 +2,38 @@ package memory
 
 import (
     "container/list"
+    "encoding/base64"
+    "errors"
     "github.com/jimmyzhouj/session"
+    "sort"
     "sync"
     "time"
 )
 
-var pder = &Provider{list: list.New()}
+var pder = &Provider{list: list.New(), now: time.Now}
 
 type SessionStore struct {
+    lock         sync.Mutex                  //保护value
     sid          string                      //session id唯一标示
     timeAccessed time.Time                   //最后访问时间
     value        map[interface{}]interface{} //session里面存储的值
+    modified     map[interface{}]time.Time   //每个值最后修改时间
+    lifetime     int64                       //自己的生命周期(秒), 0为默认, pder.lock保护
 }
 
 func (st *SessionStore) Set(key, value interface{}) error {
+    st.lock.Lock()
     st.value[key] = value
+    st.modified[key] = pder.now()
+    st.lock.Unlock()
     pder.SessionUpdate(st.sid)
     return nil
 }
 
 func (st *SessionStore) Get(key interface{}) interface{} {
     pder.SessionUpdate(st.sid)
+    st.lock.Lock()
+    defer st.lock.Unlock()
     if v, ok := st.value[key]; ok {
         return v
     } else {
@@ -32,7 +43,69 @@ func (st *SessionStore) Get(key interface{}) interface{} {
 }
 
 func (st *SessionStore) Delete(key interface{}) error {
+    st.lock.Lock()
     delete(st.value, key)
+    delete(st.modified, key)
+    st.lock.Unlock()
+    pder.SessionUpdate(st.sid)
+    return nil
+}
+
+// DeleteIfPresent delete key and report whether it held a value
+func (st *SessionStore) DeleteIfPresent(key interface{}) (bool, error) {
+    st.lock.Lock()
+    _, ok := st.value[key]
+    delete(st.value, key)
+    delete(st.modified, key)
+    st.lock.Unlock()
+    pder.SessionUpdate(st.sid)
+    return ok, nil
+}
+
+func (st *SessionStore) Rename(oldKey, newKey interface{}) error {
+    st.lock.Lock()
+    v, ok := st.value[oldKey]
+    if ok {
+        delete(st.value, oldKey)
+        delete(st.modified, oldKey)
+        st.value[newKey] = v
+        st.modified[newKey] = pder.now()
+    }
+    st.lock.Unlock()
+    pder.SessionUpdate(st.sid)
+    return nil
+}
+
+func (st *SessionStore) KeyModifiedAt(key interface{}) (time.Time, bool) {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    t, ok := st.modified[key]
+    return t, ok
+}
+
+func (st *SessionStore) Snapshot() map[interface{}]interface{} {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    values := make(map[interface{}]interface{}, len(st.value))
+    for k, v := range st.value {
+        values[k] = v
+    }
+    return values
+}
+
+// Apply set and delete several values under one lock
+func (st *SessionStore) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    st.lock.Lock()
+    for _, k := range deleted {
+        delete(st.value, k)
+        delete(st.modified, k)
+    }
+    now := pder.now()
+    for k, v := range set {
+        st.value[k] = v
+        st.modified[k] = now
+    }
+    st.lock.Unlock()
     pder.SessionUpdate(st.sid)
     return nil
 }
@@ -41,64 +114,268 @@ func (st *SessionStore) SessionID() string {
     return st.sid
 }
 
+// sessionView is what one SessionInit or SessionRead returns: the shared
+// SessionStore plus values set with SetTransient, which only this view sees
+type sessionView struct {
+    *SessionStore
+    transient map[interface{}]interface{}
+}
+
+func newView(st *SessionStore) *sessionView {
+    return &sessionView{SessionStore: st}
+}
+
+func (v *sessionView) SetTransient(key, value interface{}) {
+    if v.transient == nil {
+        v.transient = make(map[interface{}]interface{})
+    }
+    v.transient[key] = value
+}
+
+func (v *sessionView) Set(key, value interface{}) error {
+    delete(v.transient, key)
+    return v.SessionStore.Set(key, value)
+}
+
+func (v *sessionView) Get(key interface{}) interface{} {
+    if value, ok := v.transient[key]; ok {
+        return value
+    }
+    return v.SessionStore.Get(key)
+}
+
+func (v *sessionView) Delete(key interface{}) error {
+    delete(v.transient, key)
+    return v.SessionStore.Delete(key)
+}
+
+func (v *sessionView) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    for _, k := range deleted {
+        delete(v.transient, k)
+    }
+    for k := range set {
+        delete(v.transient, k)
+    }
+    return v.SessionStore.Apply(set, deleted)
+}
+
+func (v *sessionView) Begin() (session.Session, func() error) {
+    return session.NewView(v)
+}
+
+func (v *sessionView) DeleteIfPresent(key interface{}) (bool, error) {
+    _, ok := v.transient[key]
+    delete(v.transient, key)
+    stored, err := v.SessionStore.DeleteIfPresent(key)
+    return ok || stored, err
+}
+
 type Provider struct {
-    lock     sync.Mutex               //用来锁
-    sessions map[string]*list.Element //用来存储在内存
-    list     *list.List               //用来做gc
+    lock      sync.RWMutex                                           //用来锁
+    sessions  map[string]*list.Element                               //用来存储在内存
+    list      *list.List                                             //用来做gc
+    now       func() time.Time                                       //时钟
+    gcReports []func(collected int)                                  //gc回调
+    expires   []func(sid string, values map[interface{}]interface{}) //gc删除session回调
+    gcLimiter *session.RateLimiter                                   //gc删除限速
+    ownLife   int                                                    //有自己生命周期的session数
+}
+
+// SetClock replace the clock used for access and modification times, for tests
+func SetClock(now func() time.Time) {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.now = now
 }
 
 func (pder *Provider) SessionInit(sid string) (session.Session, error) {
     pder.lock.Lock()
     defer pder.lock.Unlock()
+    if _, ok := pder.sessions[sid]; ok {
+        return nil, session.ErrSIDCollision
+    }
     v := make(map[interface{}]interface{}, 0)
-    newsess := &SessionStore{sid: sid, timeAccessed: time.Now(), value: v}
-    element := pder.list.PushBack(newsess)
+    newsess := &SessionStore{sid: sid, timeAccessed: pder.now(), value: v, modified: make(map[interface{}]time.Time)}
+    element := pder.list.PushFront(newsess)
     pder.sessions[sid] = element
-    return newsess, nil
+    return newView(newsess), nil
 }
 
 func (pder *Provider) SessionRead(sid string) (session.Session, error) {
-    if element, ok := pder.sessions[sid]; ok {
-        return element.Value.(*SessionStore), nil
-    } else {
-        sess, err := pder.SessionInit(sid)
-        return sess, err
+    pder.lock.RLock()
+    element, ok := pder.sessions[sid]
+    pder.lock.RUnlock()
+    if ok {
+        return newView(element.Value.(*SessionStore)), nil
     }
-    return nil, nil
+    sess, err := pder.SessionInit(sid)
+    if err == session.ErrSIDCollision {
+        // created by someone else meanwhile
+        return pder.SessionRead(sid)
+    }
+    return sess, err
 }
 
 func (pder *Provider) SessionDestroy(sid string) error {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
     if element, ok := pder.sessions[sid]; ok {
-        delete(pder.sessions, sid)
-        pder.list.Remove(element)
+        pder.remove(element)
         return nil
     }
     return nil
 }
 
-func (pder *Provider) SessionGC(maxlifetime int64) {
+// caller must hold the lock
+func (pder *Provider) remove(element *list.Element) {
+    st := element.Value.(*SessionStore)
+    if st.lifetime > 0 {
+        pder.ownLife--
+    }
+    delete(pder.sessions, st.sid)
+    pder.list.Remove(element)
+}
+
+// SetLifetime let sid expire after lifetime seconds of inactivity instead of
+// the maxlifetime given to SessionGC, lifetime <= 0 restores that
+func (pder *Provider) SetLifetime(sid string, lifetime int64) error {
     pder.lock.Lock()
     defer pder.lock.Unlock()
+    element, ok := pder.sessions[sid]
+    if !ok {
+        return nil
+    }
+    st := element.Value.(*SessionStore)
+    if lifetime < 0 {
+        lifetime = 0
+    }
+    if st.lifetime == 0 && lifetime > 0 {
+        pder.ownLife++
+    } else if st.lifetime > 0 && lifetime == 0 {
+        pder.ownLife--
+    }
+    st.lifetime = lifetime
+    return nil
+}
+
+// report whether st was last accessed more than its lifetime before now, caller must hold the lock
+func expired(st *SessionStore, now, maxlifetime int64) bool {
+    lifetime := maxlifetime
+    if st.lifetime > 0 {
+        lifetime = st.lifetime
+    }
+    return st.timeAccessed.Unix() < now-lifetime
+}
+
+// SessionGC snapshot the expired sids under the read lock, then remove
+// those still expired under the write lock, so sessions created or
+// accessed meanwhile are kept
+func (pder *Provider) SessionGC(maxlifetime int64) {
+    now := pder.now().Unix()
+
+    pder.lock.RLock()
+    limiter := pder.gcLimiter
+    var candidates []string
+    for element := pder.list.Back(); element != nil; element = element.Prev() {
+        st := element.Value.(*SessionStore)
+        if !expired(st, now, maxlifetime) {
+            // the list is ordered by access time, unless sessions have their own lifetime
+            if pder.ownLife == 0 {
+                break
+            }
+            continue
+        }
+        candidates = append(candidates, st.sid)
+    }
+    pder.lock.RUnlock()
+
+    if len(candidates) == 0 {
+        return
+    }
+
+    pder.lock.Lock()
+    var collected []*SessionStore
+    for _, sid := range candidates {
+        if limiter != nil {
+            pder.lock.Unlock()
+            limiter.Wait()
+            pder.lock.Lock()
+        }
+        element, ok := pder.sessions[sid]
+        if !ok || !expired(element.Value.(*SessionStore), now, maxlifetime) {
+            continue
+        }
+        pder.remove(element)
+        collected = append(collected, element.Value.(*SessionStore))
+    }
+    reports, expires := pder.gcReports, pder.expires
+    pder.lock.Unlock()
 
-    for {
-        element := pder.list.Back()
-        if element == nil {
-            break
+    for _, notify := range expires {
+        for _, st := range collected {
+            notify(st.sid, st.Snapshot())
         }
-        if (element.Value.(*SessionStore).timeAccessed.Unix() + maxlifetime) < time.Now().Unix() {
-            pder.list.Remove(element)
-            delete(pder.sessions, element.Value.(*SessionStore).sid)
-        } else {
-            break
+    }
+    for _, report := range reports {
+        report(len(collected))
+    }
+}
+
+// OnExpire register a callback told about every session SessionGC removed
+func (pder *Provider) OnExpire(notify func(sid string, values map[interface{}]interface{})) {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.expires = append(pder.expires, notify)
+}
+
+// SetGCRateLimit limit SessionGC to opsPerSec deletions per second,
+// opsPerSec <= 0 removes the limit
+func (pder *Provider) SetGCRateLimit(opsPerSec int) {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.gcLimiter = session.NewRateLimiter(opsPerSec)
+}
+
+// OnGC register a callback told how many sessions each SessionGC removed
+func (pder *Provider) OnGC(report func(collected int)) {
+    pder.lock.Lock()
+    defer pder.lock.Unlock()
+    pder.gcReports = append(pder.gcReports, report)
+}
+
+// ListSessions page through the sids in lexical order, the cursor is the
+// last sid of the previous page, base64 encoded. limit <= 0 means
+// session.DefaultListLimit
+func (pder *Provider) ListSessions(cursor string, limit int) ([]string, string, error) {
+    if limit <= 0 {
+        limit = session.DefaultListLimit
+    }
+    after, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return nil, "", errors.New("memory: invalid cursor")
+    }
+    pder.lock.RLock()
+    sids := make([]string, 0, len(pder.sessions))
+    for sid := range pder.sessions {
+        if cursor == "" || sid > string(after) {
+            sids = append(sids, sid)
         }
     }
+    pder.lock.RUnlock()
+
+    sort.Strings(sids)
+    if len(sids) <= limit {
+        return sids, "", nil
+    }
+    sids = sids[:limit]
+    return sids, base64.RawURLEncoding.EncodeToString([]byte(sids[limit-1])), nil
 }
 
 func (pder *Provider) SessionUpdate(sid string) error {
     pder.lock.Lock()
     defer pder.lock.Unlock()
     if element, ok := pder.sessions[sid]; ok {
-        element.Value.(*SessionStore).timeAccessed = time.Now()
+        element.Value.(*SessionStore).timeAccessed = pder.now()
         pder.list.MoveToFront(element)
         return nil
     }
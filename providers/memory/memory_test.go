@@ -0,0 +1,292 @@
+package memory
+
+import (
+    "container/list"
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+    "github.com/jimmyzhouj/session"
+)
+
+// empty the provider and stop its clock at a fixed time for the test,
+// advance moves the clock on
+func resetProvider(t *testing.T) (advance func(d time.Duration)) {
+    t.Helper()
+    set := func(now func() time.Time) {
+        pder.lock.Lock()
+        defer pder.lock.Unlock()
+        pder.sessions = make(map[string]*list.Element)
+        pder.list.Init()
+        pder.gcReports, pder.expires = nil, nil
+        pder.gcLimiter = nil
+        pder.ownLife = 0
+        pder.now = now
+    }
+    now := time.Unix(1700000000, 0)
+    var lock sync.Mutex
+    set(func() time.Time {
+        lock.Lock()
+        defer lock.Unlock()
+        return now
+    })
+    t.Cleanup(func() { set(time.Now) })
+    return func(d time.Duration) {
+        lock.Lock()
+        defer lock.Unlock()
+        now = now.Add(d)
+    }
+}
+
+func TestRename(t *testing.T) {
+    advance := resetProvider(t)
+    sess, err := pder.SessionInit("sid1")
+    if err != nil {
+        t.Fatalf("SessionInit: %v", err)
+    }
+    sess.Set("old", "v")
+    advance(time.Minute)
+    if err := sess.Rename("old", "new"); err != nil {
+        t.Fatalf("Rename: %v", err)
+    }
+    if got := sess.Get("old"); got != nil {
+        t.Fatalf("old key after Rename = %v, want nil", got)
+    }
+    if got := sess.Get("new"); got != "v" {
+        t.Fatalf("new key after Rename = %v, want v", got)
+    }
+    if at, ok := sess.KeyModifiedAt("new"); !ok || !at.Equal(pder.now()) {
+        t.Fatalf("new key modified at %v, %v, want the time of Rename", at, ok)
+    }
+
+    if err := sess.Rename("missing", "other"); err != nil {
+        t.Fatalf("Rename of a missing key: %v", err)
+    }
+    if got := sess.Get("other"); got != nil {
+        t.Fatalf("Rename of a missing key set %v", got)
+    }
+
+    // an existing destination is overwritten
+    sess.Set("taken", "old value")
+    if err := sess.Rename("new", "taken"); err != nil {
+        t.Fatalf("Rename onto an existing key: %v", err)
+    }
+    if sess.Get("taken") != "v" || sess.Get("new") != nil {
+        t.Fatalf("values after Rename onto an existing key = %v, want taken overwritten", sess.(session.Snapshotter).Snapshot())
+    }
+}
+
+// run with -race: GC scans under the read lock while sessions are created
+func TestSessionGCConcurrentInit(t *testing.T) {
+    advance := resetProvider(t)
+    for i := 0; i < 50; i++ {
+        pder.SessionInit(fmt.Sprintf("old%d", i))
+    }
+    advance(2 * time.Hour)
+
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 200; i++ {
+            if _, err := pder.SessionInit(fmt.Sprintf("new%d", i)); err != nil {
+                t.Errorf("SessionInit: %v", err)
+            }
+        }
+    }()
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 20; i++ {
+            pder.SessionGC(3600)
+        }
+    }()
+    wg.Wait()
+    pder.SessionGC(3600)
+
+    pder.lock.RLock()
+    defer pder.lock.RUnlock()
+    for i := 0; i < 50; i++ {
+        if _, ok := pder.sessions[fmt.Sprintf("old%d", i)]; ok {
+            t.Fatalf("expired session old%d survived GC", i)
+        }
+    }
+    for i := 0; i < 200; i++ {
+        if _, ok := pder.sessions[fmt.Sprintf("new%d", i)]; !ok {
+            t.Fatalf("session new%d created during GC was collected", i)
+        }
+    }
+    if pder.list.Len() != len(pder.sessions) {
+        t.Fatalf("gc list holds %d sessions, map %d", pder.list.Len(), len(pder.sessions))
+    }
+}
+
+func TestSessionInitCollision(t *testing.T) {
+    resetProvider(t)
+    pder.SessionInit("sid1")
+    if _, err := pder.SessionInit("sid1"); err != session.ErrSIDCollision {
+        t.Fatalf("second SessionInit = %v, want ErrSIDCollision", err)
+    }
+}
+
+func TestKeyModifiedAt(t *testing.T) {
+    advance := resetProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    sess.Set("a", 1)
+    set := pder.now()
+    advance(time.Minute)
+    sess.Set("b", 2)
+
+    if at, ok := sess.KeyModifiedAt("a"); !ok || !at.Equal(set) {
+        t.Fatalf("a modified at %v, %v, want %v", at, ok, set)
+    }
+    if at, ok := sess.KeyModifiedAt("b"); !ok || !at.Equal(set.Add(time.Minute)) {
+        t.Fatalf("b modified at %v, %v, want a minute later", at, ok)
+    }
+    sess.Delete("a")
+    if _, ok := sess.KeyModifiedAt("a"); ok {
+        t.Fatal("deleted key still has a modification time")
+    }
+    read, _ := pder.SessionRead("sid1")
+    if _, ok := read.KeyModifiedAt("b"); !ok {
+        t.Fatal("modification time lost on SessionRead")
+    }
+}
+
+func TestOnGC(t *testing.T) {
+    advance := resetProvider(t)
+    pder.SessionInit("old1")
+    pder.SessionInit("old2")
+    advance(2 * time.Hour)
+    pder.SessionInit("fresh")
+    var reports []int
+    pder.OnGC(func(collected int) { reports = append(reports, collected) })
+
+    pder.SessionGC(3600)
+    if len(reports) != 1 || reports[0] != 2 {
+        t.Fatalf("GC reports = %v, want one report of 2", reports)
+    }
+}
+
+func TestSetTransient(t *testing.T) {
+    resetProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    sess.SetTransient("request", "r1")
+    if got := sess.Get("request"); got != "r1" {
+        t.Fatalf("transient value = %v, want r1", got)
+    }
+    sess.Set("user", "alice")
+    read, _ := pder.SessionRead("sid1")
+    if read.Get("request") != nil || read.Get("user") != "alice" {
+        t.Fatalf("fresh read = %v, want only the persisted values", read.(session.Snapshotter).Snapshot())
+    }
+
+    // Set makes the key persistent again
+    sess.Set("request", "r2")
+    if read, _ := pder.SessionRead("sid1"); read.Get("request") != "r2" {
+        t.Fatal("Set of a transient key wasn't stored")
+    }
+}
+
+func TestDeleteIfPresent(t *testing.T) {
+    resetProvider(t)
+    sess, _ := pder.SessionInit("sid1")
+    d := sess.(interface {
+        DeleteIfPresent(key interface{}) (bool, error)
+    })
+    sess.Set("user", "alice")
+    sess.SetTransient("request", "r1")
+    for _, key := range []string{"user", "request"} {
+        if ok, err := d.DeleteIfPresent(key); !ok || err != nil {
+            t.Errorf("DeleteIfPresent(%q) = %v, %v, want true", key, ok, err)
+        }
+        if ok, err := d.DeleteIfPresent(key); ok || err != nil {
+            t.Errorf("second DeleteIfPresent(%q) = %v, %v, want false", key, ok, err)
+        }
+    }
+}
+
+// run with -race: the paced GC drops the lock between deletions
+func TestSessionGCRateLimit(t *testing.T) {
+    advance := resetProvider(t)
+    for i := 0; i < 12; i++ {
+        pder.SessionInit(fmt.Sprintf("old%d", i))
+    }
+    advance(2 * time.Hour)
+    pder.SessionInit("fresh")
+    pder.SetGCRateLimit(10)
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for i := 0; i < 10; i++ {
+            pder.SessionRead("fresh")
+        }
+    }()
+    start := time.Now()
+    pder.SessionGC(3600)
+    <-done
+    if d := time.Since(start); d < 150*time.Millisecond {
+        t.Fatalf("GC of 12 sessions at 10 per second took %v, want it paced", d)
+    }
+    if _, err := pder.SessionInit("old0"); err != nil {
+        t.Fatal("paced GC left an expired session")
+    }
+    if _, err := pder.SessionInit("fresh"); err != session.ErrSIDCollision {
+        t.Fatal("paced GC removed a fresh session")
+    }
+}
+
+func TestSetLifetime(t *testing.T) {
+    advance := resetProvider(t)
+    pder.SessionInit("older")
+    advance(time.Minute)
+    // newer than older, so GC can't stop at the first unexpired session
+    pder.SessionInit("short")
+    pder.SetLifetime("short", 30)
+    advance(time.Minute)
+
+    pder.SessionGC(3600)
+    if _, err := pder.SessionInit("short"); err != nil {
+        t.Fatal("session past its own lifetime was kept")
+    }
+    if _, err := pder.SessionInit("older"); err != session.ErrSIDCollision {
+        t.Fatal("session within maxlifetime was collected")
+    }
+
+    pder.SetLifetime("short", 30)
+    pder.SetLifetime("short", 0)
+    advance(time.Minute)
+    pder.SessionGC(3600)
+    if _, err := pder.SessionInit("short"); err != session.ErrSIDCollision {
+        t.Fatal("lifetime 0 didn't restore maxlifetime")
+    }
+}
+
+func TestListSessions(t *testing.T) {
+    resetProvider(t)
+    for _, sid := range []string{"e", "b", "a", "d", "c"} {
+        pder.SessionInit(sid)
+    }
+    var got []string
+    for cursor := ""; ; {
+        sids, next, err := pder.ListSessions(cursor, 2)
+        if err != nil {
+            t.Fatalf("ListSessions(%q): %v", cursor, err)
+        }
+        got = append(got, sids...)
+        if next == "" {
+            break
+        }
+        cursor = next
+    }
+    if fmt.Sprint(got) != "[a b c d e]" {
+        t.Fatalf("paged through %v, want every sid in order", got)
+    }
+
+    if sids, next, _ := pder.ListSessions("", 0); len(sids) != 5 || next != "" {
+        t.Fatalf("limit 0 = %v, %q, want one page with DefaultListLimit", sids, next)
+    }
+    if _, _, err := pder.ListSessions("not base64!", 2); err == nil {
+        t.Fatal("ListSessions accepted an invalid cursor")
+    }
+}
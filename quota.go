@@ -0,0 +1,52 @@
+package session
+
+// fraction of a limit from which a session counts as near it
+const nearLimitRatio = 0.9
+
+// QuotaStatus compare the size of a session with the configured limits,
+// a limit of 0 means unlimited
+type QuotaStatus struct {
+    Keys      int
+    Bytes     int
+    MaxKeys   int
+    MaxBytes  int
+    NearLimit bool // at or above 90% of a limit
+    OverLimit bool // above a limit
+}
+
+// set the key count and encoded size limits Quota reports against, 0 for none.
+// the limits are not enforced by the manager
+func (manager *Manager) SetQuotaLimits(maxKeys, maxBytes int) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.maxKeys = maxKeys
+    manager.maxBytes = maxBytes
+}
+
+// Quota report how close s is to the configured key and size limits.
+// reserved keys are not counted, the size is the one of SessionSizeBytes
+func (manager *Manager) Quota(s Session) (QuotaStatus, error) {
+    snap, ok := unwrapSession(s).(Snapshotter)
+    if !ok {
+        return QuotaStatus{}, errNoSnapshot
+    }
+    size, err := manager.SessionSizeBytes(s)
+    if err != nil {
+        return QuotaStatus{}, err
+    }
+    status := QuotaStatus{Keys: countKeys(snap.Snapshot()), Bytes: size, MaxKeys: manager.maxKeys, MaxBytes: manager.maxBytes}
+    check := func(n, max int) {
+        if max <= 0 {
+            return
+        }
+        if float64(n) >= nearLimitRatio*float64(max) {
+            status.NearLimit = true
+        }
+        if n > max {
+            status.OverLimit = true
+        }
+    }
+    check(status.Keys, status.MaxKeys)
+    check(status.Bytes, status.MaxBytes)
+    return status, nil
+}
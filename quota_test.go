@@ -0,0 +1,41 @@
+package session
+
+import (
+    "fmt"
+    "testing"
+)
+
+func TestQuota(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s := manager.ApiSessionCreate()
+    for i := 0; i < 9; i++ {
+        s.Set(fmt.Sprintf("k%d", i), i)
+    }
+
+    status, err := manager.Quota(s)
+    if err != nil || status.Keys != 9 || status.NearLimit || status.OverLimit {
+        t.Fatalf("Quota without limits = %+v, %v, want 9 keys and no limit hit", status, err)
+    }
+    if size, _ := manager.SessionSizeBytes(s); status.Bytes != size {
+        t.Fatalf("Quota bytes = %d, want SessionSizeBytes %d", status.Bytes, size)
+    }
+
+    manager.SetQuotaLimits(10, 0)
+    if status, _ := manager.Quota(s); !status.NearLimit || status.OverLimit {
+        t.Fatalf("9 of 10 keys = %+v, want near the limit only", status)
+    }
+    s.Set("k9", 9)
+    s.Set("k10", 10)
+    if status, _ := manager.Quota(s); !status.OverLimit {
+        t.Fatalf("11 of 10 keys = %+v, want over the limit", status)
+    }
+
+    manager.SetQuotaLimits(0, 10)
+    if status, _ := manager.Quota(s); !status.OverLimit || status.MaxBytes != 10 {
+        t.Fatalf("byte limit of 10 = %+v, want over the limit", status)
+    }
+
+    if _, err := manager.Quota(struct{ Session }{s}); err != errNoSnapshot {
+        t.Fatalf("Quota of a session without Snapshot = %v, want errNoSnapshot", err)
+    }
+}
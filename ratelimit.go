@@ -0,0 +1,62 @@
+package session
+
+import (
+    "sync"
+    "time"
+)
+
+// GCRateLimiter is implemented by providers which can pace the deletions of
+// their SessionGC, opsPerSec <= 0 removes the limit
+type GCRateLimiter interface {
+    SetGCRateLimit(opsPerSec int)
+}
+
+// RateLimiter is a token bucket allowing rate operations per second, with
+// bursts of up to rate. a nil *RateLimiter never waits
+type RateLimiter struct {
+    lock   sync.Mutex
+    rate   float64
+    tokens float64
+    last   time.Time
+}
+
+// NewRateLimiter return a limiter for opsPerSec, nil when opsPerSec <= 0
+func NewRateLimiter(opsPerSec int) *RateLimiter {
+    if opsPerSec <= 0 {
+        return nil
+    }
+    return &RateLimiter{rate: float64(opsPerSec), tokens: float64(opsPerSec), last: time.Now()}
+}
+
+// Wait block until the next operation is allowed
+func (l *RateLimiter) Wait() {
+    if l == nil {
+        return
+    }
+    l.lock.Lock()
+    now := time.Now()
+    l.tokens += now.Sub(l.last).Seconds() * l.rate
+    if l.tokens > l.rate {
+        l.tokens = l.rate
+    }
+    l.last = now
+    l.tokens--
+    var wait time.Duration
+    if l.tokens < 0 {
+        // the token is taken now, paid for by waiting until it is refilled
+        wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+    }
+    l.lock.Unlock()
+    time.Sleep(wait)
+}
+
+// limit how many sessions per second the provider's SessionGC deletes, so a
+// large collection doesn't overwhelm the store. the provider must be a
+// GCRateLimiter, otherwise this does nothing. opsPerSec <= 0 removes the limit
+func (manager *Manager) SetGCRateLimit(opsPerSec int) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    if limiter, ok := manager.provider.(GCRateLimiter); ok {
+        limiter.SetGCRateLimit(opsPerSec)
+    }
+}
@@ -0,0 +1,52 @@
+package session
+
+import (
+    "testing"
+    "time"
+)
+
+// limiterProvider is a fakeProvider which is a GCRateLimiter
+type limiterProvider struct {
+    *fakeProvider
+    limit int
+}
+
+func (p *limiterProvider) SetGCRateLimit(opsPerSec int) {
+    p.limit = opsPerSec
+}
+
+func TestRateLimiter(t *testing.T) {
+    if l := NewRateLimiter(0); l != nil {
+        t.Fatalf("NewRateLimiter(0) = %v, want nil", l)
+    }
+    var none *RateLimiter
+    none.Wait()
+
+    l := NewRateLimiter(50)
+    start := time.Now()
+    for i := 0; i < 50; i++ {
+        l.Wait()
+    }
+    if d := time.Since(start); d > 100*time.Millisecond {
+        t.Fatalf("burst of 50 took %v, want no wait", d)
+    }
+    for i := 0; i < 10; i++ {
+        l.Wait()
+    }
+    if d := time.Since(start); d < 150*time.Millisecond {
+        t.Fatalf("10 operations past the burst took %v, want about 200ms", d)
+    }
+}
+
+func TestSetGCRateLimit(t *testing.T) {
+    p := &limiterProvider{fakeProvider: newFakeProvider()}
+    manager := newManagerOn(t, p)
+    manager.SetGCRateLimit(25)
+    if p.limit != 25 {
+        t.Fatalf("provider limit = %d, want 25", p.limit)
+    }
+
+    // ignored by providers without support
+    plain, _ := newTestManager(t)
+    plain.SetGCRateLimit(25)
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+    "net/http"
+    log "github.com/cihub/seelog"
+)
+
+// HeaderTracker is implemented by response writers which know whether the
+// response headers were sent. cookies and headers set after that are lost,
+// the manager logs an error instead of failing silently
+type HeaderTracker interface {
+    HeadersSent() bool
+}
+
+// TrackHeaders wrap w so the manager can tell when a session cookie is set
+// too late, after the handler already started the response. Handler does this
+func TrackHeaders(w http.ResponseWriter) http.ResponseWriter {
+    if _, ok := w.(HeaderTracker); ok {
+        return w
+    }
+    return &trackingWriter{ResponseWriter: w}
+}
+
+type trackingWriter struct {
+    http.ResponseWriter
+    sent bool
+}
+
+func (tw *trackingWriter) WriteHeader(code int) {
+    tw.sent = true
+    tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+    tw.sent = true
+    return tw.ResponseWriter.Write(b)
+}
+
+func (tw *trackingWriter) Flush() {
+    if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+        tw.sent = true
+        f.Flush()
+    }
+}
+
+func (tw *trackingWriter) HeadersSent() bool {
+    return tw.sent
+}
+
+// Unwrap return the wrapped writer, for http.ResponseController
+func (tw *trackingWriter) Unwrap() http.ResponseWriter {
+    return tw.ResponseWriter
+}
+
+// check that w can still take headers, logging what is lost when not
+func headersWritable(w http.ResponseWriter, what string) bool {
+    if t, ok := w.(HeaderTracker); ok && t.HeadersSent() {
+        log.Errorf("session: response already started, %s is not sent; call SessionStart before writing the response", what)
+        return false
+    }
+    return true
+}
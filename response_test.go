@@ -0,0 +1,59 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestTrackHeaders(t *testing.T) {
+    rec := httptest.NewRecorder()
+    w := TrackHeaders(rec)
+    if TrackHeaders(w) != w {
+        t.Fatal("TrackHeaders wrapped a tracking writer again")
+    }
+    tracker := w.(HeaderTracker)
+    if tracker.HeadersSent() {
+        t.Fatal("HeadersSent before anything was written")
+    }
+    w.(http.Flusher).Flush()
+    if !tracker.HeadersSent() || !rec.Flushed {
+        t.Fatal("Flush didn't start the response")
+    }
+    if w.(interface{ Unwrap() http.ResponseWriter }).Unwrap() != rec {
+        t.Fatal("Unwrap didn't return the wrapped writer")
+    }
+}
+
+func TestSessionStartAfterWrite(t *testing.T) {
+    manager, _ := newTestManager(t)
+    logged := captureLog(t)
+    rec := httptest.NewRecorder()
+    w := TrackHeaders(rec)
+    w.Write([]byte("too early"))
+    if s := manager.SessionStart(w, requestWith()); s == nil {
+        t.Fatal("SessionStart returned nil after the response started")
+    }
+    if rec.Header().Get("Set-Cookie") != "" {
+        t.Fatal("cookie header set after the response started")
+    }
+    if !strings.Contains(logged.String(), "ERROR session: response already started, cookie sid is not sent") {
+        t.Fatalf("late cookie not logged as an error, logged:\n%s", logged)
+    }
+
+    // the same goes for the api token header
+    manager.SetTransportSelector(apiByHeader)
+    rec = httptest.NewRecorder()
+    w = TrackHeaders(rec)
+    w.WriteHeader(http.StatusOK)
+    if s := manager.SessionStart(w, httptest.NewRequest("GET", "/api/items", nil)); s == nil {
+        t.Fatal("SessionStart over the header transport returned nil after the response started")
+    }
+    if rec.Header().Get(tokenHeader) != "" {
+        t.Fatal("token header set after the response started")
+    }
+    if !strings.Contains(logged.String(), "ERROR session: response already started, "+tokenHeader+" header is not sent") {
+        t.Fatalf("late token header not logged as an error, logged:\n%s", logged)
+    }
+}
@@ -0,0 +1,51 @@
+package session
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+// providers return ErrProviderUnavailable for transient failures worth a retry
+var ErrProviderUnavailable = errors.New("session: provider unavailable")
+
+// set how often SessionRead and SessionInit are tried when the provider
+// returns ErrProviderUnavailable. the wait before each retry starts at
+// backoff and doubles. attempts <= 1 disables retry
+func (manager *Manager) SetRetryPolicy(attempts int, backoff time.Duration) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.retryAttempts = attempts
+    manager.retryBackoff = backoff
+}
+
+// run op, retry it per the retry policy until it succeeds, fails with
+// another error or ctx is done. caller must hold the lock, it is released
+// while waiting, so one unavailable provider doesn't stall every other request
+func (manager *Manager) withRetry(ctx context.Context, op func() error) error {
+    err := op()
+    attempts, backoff := manager.retryAttempts, manager.retryBackoff
+    for i := 1; i < attempts && errors.Is(err, ErrProviderUnavailable); i++ {
+        manager.lock.Unlock()
+        err = wait(ctx, backoff)
+        manager.lock.Lock()
+        if err != nil {
+            return err
+        }
+        backoff *= 2
+        err = op()
+    }
+    return err
+}
+
+// sleep for d, or until ctx is done
+func wait(ctx context.Context, d time.Duration) error {
+    t := time.NewTimer(d)
+    defer t.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
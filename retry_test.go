@@ -0,0 +1,135 @@
+package session
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeProvider failing its first reads, failures of them, with err
+type flakyProvider struct {
+    *fakeProvider
+    lock     sync.Mutex
+    failures int
+    err      error
+    calls    []time.Time
+}
+
+func (p *flakyProvider) SessionRead(sid string) (Session, error) {
+    p.lock.Lock()
+    p.calls = append(p.calls, time.Now())
+    fail := p.failures > 0
+    if fail {
+        p.failures--
+    }
+    p.lock.Unlock()
+    if fail {
+        return nil, p.err
+    }
+    return p.fakeProvider.SessionRead(sid)
+}
+
+func newFlakyManager(t *testing.T, failures int, err error) (*Manager, *flakyProvider) {
+    t.Helper()
+    p := &flakyProvider{fakeProvider: newFakeProvider(), failures: failures, err: err}
+    manager, e := NewManager("test", "sid", 3600, WithFallbackProvider(p))
+    if e != nil {
+        t.Fatalf("NewManager: %v", e)
+    }
+    t.Cleanup(manager.Close)
+    return manager, p
+}
+
+// run a provider read for sid the way SessionStart does
+func readWithLock(manager *Manager, ctx context.Context, sid string) (Session, error) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    return manager.sessionRead(ctx, sid)
+}
+
+func TestRetryBackoff(t *testing.T) {
+    manager, p := newFlakyManager(t, 2, ErrProviderUnavailable)
+    manager.SetRetryPolicy(4, 20*time.Millisecond)
+
+    if _, err := readWithLock(manager, context.Background(), "sid1"); err != nil {
+        t.Fatalf("read after two failures = %v, want success", err)
+    }
+    if len(p.calls) != 3 {
+        t.Fatalf("provider called %d times, want 3", len(p.calls))
+    }
+    for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+        if gap := p.calls[i+1].Sub(p.calls[i]); gap < want {
+            t.Errorf("wait before retry %d = %v, want at least %v", i+1, gap, want)
+        }
+    }
+}
+
+func TestRetryGivesUp(t *testing.T) {
+    manager, p := newFlakyManager(t, 10, ErrProviderUnavailable)
+    manager.SetRetryPolicy(3, time.Millisecond)
+    _, err := readWithLock(manager, context.Background(), "sid1")
+    if !errors.Is(err, ErrProviderUnavailable) {
+        t.Fatalf("read = %v, want ErrProviderUnavailable", err)
+    }
+    if len(p.calls) != 3 {
+        t.Fatalf("provider called %d times, want 3", len(p.calls))
+    }
+}
+
+func TestRetryOnlyUnavailable(t *testing.T) {
+    other := errors.New("disk full")
+    manager, p := newFlakyManager(t, 10, other)
+    manager.SetRetryPolicy(3, time.Millisecond)
+    if _, err := readWithLock(manager, context.Background(), "sid1"); !errors.Is(err, other) {
+        t.Fatalf("read = %v, want the provider error", err)
+    }
+    if len(p.calls) != 1 {
+        t.Fatalf("provider called %d times, want no retry", len(p.calls))
+    }
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+    manager, _ := newFlakyManager(t, 10, ErrProviderUnavailable)
+    manager.SetRetryPolicy(5, time.Hour)
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if _, err := readWithLock(manager, ctx, "sid1"); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("read = %v, want the context error", err)
+    }
+}
+
+func TestRetryReleasesLockWhileWaiting(t *testing.T) {
+    manager, p := newFlakyManager(t, 1, ErrProviderUnavailable)
+    manager.SetRetryPolicy(2, 300*time.Millisecond)
+
+    done := make(chan error)
+    go func() {
+        _, err := readWithLock(manager, context.Background(), "sid1")
+        done <- err
+    }()
+    for {
+        p.lock.Lock()
+        n := len(p.calls)
+        p.lock.Unlock()
+        if n > 0 {
+            break
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    locked := make(chan struct{})
+    go func() {
+        manager.SetCookieNameSuffix("")
+        close(locked)
+    }()
+    select {
+    case <-locked:
+    case <-time.After(150 * time.Millisecond):
+        t.Fatal("manager lock held during the retry backoff")
+    }
+    if err := <-done; err != nil {
+        t.Fatalf("read = %v", err)
+    }
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+    "errors"
+    "net/url"
+    "strings"
+)
+
+// reserved key holding the url to return to after login
+const keyReturnTo = "_session_return_to"
+
+var ErrUnsafeReturnTo = errors.New("session: return url must be a relative path")
+
+// report whether u is a path on this site, so redirecting to it can't lead elsewhere
+func safeReturnTo(u string) bool {
+    if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") || strings.ContainsAny(u, "\\\r\n\t") {
+        return false
+    }
+    parsed, err := url.Parse(u)
+    return err == nil && parsed.Scheme == "" && parsed.Host == "" && parsed.User == nil
+}
+
+// SetReturnTo remember u in s for TakeReturnTo, typically the page which sent
+// the user to the login. u must be a path like "/account?tab=1", anything
+// else is refused with ErrUnsafeReturnTo to prevent open redirects
+func (manager *Manager) SetReturnTo(s Session, u string) error {
+    if !safeReturnTo(u) {
+        return ErrUnsafeReturnTo
+    }
+    return s.Set(keyReturnTo, u)
+}
+
+// TakeReturnTo return the url stored by SetReturnTo and forget it, or
+// fallback when there is none
+func (manager *Manager) TakeReturnTo(s Session, fallback string) string {
+    u, _ := s.Get(keyReturnTo).(string)
+    if u == "" {
+        return fallback
+    }
+    s.Delete(keyReturnTo)
+    if !safeReturnTo(u) {
+        return fallback
+    }
+    return u
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+    "net/http/httptest"
+    "testing"
+)
+
+func TestReturnTo(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, c := startNew(t, manager)
+    for _, u := range []string{"https://evil.example/", "//evil.example/", "/\\evil.example", "account", "/a\r\nLocation: x", "javascript:alert(1)"} {
+        if err := manager.SetReturnTo(s, u); err != ErrUnsafeReturnTo {
+            t.Errorf("SetReturnTo(%q) = %v, want ErrUnsafeReturnTo", u, err)
+        }
+    }
+    if got := manager.TakeReturnTo(s, "/home"); got != "/home" {
+        t.Fatalf("TakeReturnTo without a stored url = %q, want the fallback", got)
+    }
+
+    if err := manager.SetReturnTo(s, "/account?tab=1"); err != nil {
+        t.Fatalf("SetReturnTo: %v", err)
+    }
+    // kept across the login which replaces the session
+    s, err := manager.Login(httptest.NewRecorder(), requestWith(c), "alice")
+    if err != nil {
+        t.Fatalf("Login: %v", err)
+    }
+    if got := manager.TakeReturnTo(s, "/home"); got != "/account?tab=1" {
+        t.Fatalf("TakeReturnTo after login = %q, want the stored url", got)
+    }
+    if got := manager.TakeReturnTo(s, "/home"); got != "/home" {
+        t.Fatalf("second TakeReturnTo = %q, want the url forgotten", got)
+    }
+
+    // a value stored behind the manager's back is checked again
+    s.Set(keyReturnTo, "//evil.example/")
+    if got := manager.TakeReturnTo(s, "/home"); got != "/home" {
+        t.Fatalf("TakeReturnTo of an unsafe stored url = %q, want the fallback", got)
+    }
+}
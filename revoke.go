@@ -0,0 +1,39 @@
+package session
+
+import (
+    "context"
+    "errors"
+    log "github.com/cihub/seelog"
+)
+
+// reserved key flagging a session RevokeByID revoked
+const keyRevoked = "_session_revoked"
+
+var ErrRevoked = errors.New("session: session was revoked")
+
+// RevokeByID flag the session sid as revoked in the store. whichever manager
+// over the same store reads it next destroys it and treats the sid as unknown,
+// so a logout reaches every instance. revoking an unknown sid does nothing
+func (manager *Manager) RevokeByID(sid string) error {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    session := manager.lookup(context.Background(), sid)
+    if session == nil {
+        return nil
+    }
+    return session.Set(keyRevoked, true)
+}
+
+// destroy session if it was revoked and report whether it was, caller must hold the lock
+func (manager *Manager) dropRevoked(session Session) bool {
+    if revoked, _ := session.Get(keyRevoked).(bool); !revoked {
+        return false
+    }
+    sid := session.SessionID()
+    log.Infof("session %s was revoked, destroy it", manager.redactSID(sid))
+    manager.notifyDestroy(session)
+    if err := manager.sessionDestroy(sid); err != nil {
+        log.Errorf("destroy session for id %s failed\n", manager.redactSID(sid))
+    }
+    return true
+}
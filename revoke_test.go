@@ -0,0 +1,36 @@
+package session
+
+import (
+    "errors"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestRevokeByID(t *testing.T) {
+    p := newFakeProvider()
+    first, second := newManagerOn(t, p), newManagerOn(t, p)
+    s, c := startNew(t, first)
+    sid := s.SessionID()
+
+    if err := second.RevokeByID(sid); err != nil {
+        t.Fatalf("RevokeByID: %v", err)
+    }
+    got := first.SessionStart(httptest.NewRecorder(), requestWith(c))
+    if got.SessionID() == sid {
+        t.Fatal("revoked session resumed by the other manager")
+    }
+    if p.stored(sid) != nil {
+        t.Fatal("revoked session still stored after it was read")
+    }
+
+    other, _ := startNew(t, first)
+    second.RevokeByID(other.SessionID())
+    if _, err := first.Checkout(other.SessionID()); !errors.Is(err, ErrRevoked) {
+        t.Fatalf("Checkout of a revoked session = %v, want ErrRevoked", err)
+    }
+
+    unknown := first.sessionId()
+    if err := first.RevokeByID(unknown); err != nil || p.stored(unknown) != nil {
+        t.Fatalf("RevokeByID of an unknown sid = %v, stored %v, want nothing done", err, p.stored(unknown) != nil)
+    }
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    log "github.com/cihub/seelog"
+)
+
+// prefix of the sids SelfTest uses, never produced by sessionId
+const selfTestPrefix = "_session_selftest_"
+
+// SelfTest check the provider end to end: create a throwaway session, write
+// a value, read it back and destroy the session, which happens even when a
+// step fails. no user session is touched, suitable for health checks
+func (manager *Manager) SelfTest(ctx context.Context) (err error) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+
+    token := manager.sessionId()
+    if token == "" {
+        return errors.New("session: self test can't generate session id")
+    }
+    sid := selfTestPrefix + token
+    session, err := manager.sessionInit(ctx, sid)
+    if err != nil {
+        return fmt.Errorf("session: self test init: %w", err)
+    }
+    defer func() {
+        if derr := manager.sessionDestroy(sid); derr != nil {
+            log.Errorf("destroy self test session %s failed: %v", manager.redactSID(sid), derr)
+            if err == nil {
+                err = fmt.Errorf("session: self test destroy: %w", derr)
+            }
+        }
+    }()
+
+    if manager.migrations != nil {
+        // keep migrations from running on the test session when it is read
+        if err := session.Set(keyVersion, int64(len(manager.migrations))); err != nil {
+            return fmt.Errorf("session: self test write: %w", err)
+        }
+    }
+    if err := session.Set(selfTestPrefix+"value", token); err != nil {
+        return fmt.Errorf("session: self test write: %w", err)
+    }
+    read, err := manager.sessionRead(ctx, sid)
+    if err != nil {
+        return fmt.Errorf("session: self test read: %w", err)
+    }
+    if read == nil || read.Get(selfTestPrefix+"value") != token {
+        return errors.New("session: self test read back a different value")
+    }
+    return nil
+}
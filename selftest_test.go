@@ -0,0 +1,45 @@
+package session
+
+import (
+    "context"
+    "errors"
+    "testing"
+)
+
+// forgetfulProvider lose every write, SessionRead returns an empty session
+type forgetfulProvider struct {
+    *fakeProvider
+}
+
+func (p forgetfulProvider) SessionRead(sid string) (Session, error) {
+    return newTransientSession(sid), nil
+}
+
+func TestSelfTest(t *testing.T) {
+    manager, p := newTestManager(t)
+    if err := manager.SelfTest(context.Background()); err != nil {
+        t.Fatalf("SelfTest: %v", err)
+    }
+    if len(p.sessions) != 0 {
+        t.Fatalf("SelfTest left %d sessions in the store", len(p.sessions))
+    }
+
+    p.readErr = errors.New("store down")
+    if err := manager.SelfTest(context.Background()); !errors.Is(err, p.readErr) {
+        t.Fatalf("SelfTest with a failing read = %v, want the read error", err)
+    }
+    if len(p.sessions) != 0 {
+        t.Fatal("failed SelfTest left its session in the store")
+    }
+}
+
+func TestSelfTestLostWrite(t *testing.T) {
+    p := forgetfulProvider{newFakeProvider()}
+    manager := newManagerOn(t, p)
+    if err := manager.SelfTest(context.Background()); err == nil {
+        t.Fatal("SelfTest passed on a store losing writes")
+    }
+    if len(p.sessions) != 0 {
+        t.Fatal("failed SelfTest left its session in the store")
+    }
+}
@@ -3,13 +3,18 @@
 package session
 
 import (
+    "context"
+    "errors"
     "fmt"
     "crypto/rand"
     "sync"
     "io"
     "encoding/base64"
+    "net"
     "net/http"
     "net/url"
+    "strings"
+    "time"
     log "github.com/cihub/seelog"        
 )
     
@@ -23,15 +28,42 @@ type Provider interface {
 }
 
 type Session interface {
-    Set(key, value interface{}) error //set session value
-    Get(key interface{}) interface{}  //get session value
-    Delete(key interface{}) error     //delete session value
-    SessionID() string                //back current sessionID
+    Set(key, value interface{}) error                //set session value
+    Get(key interface{}) interface{}                 //get session value
+    Delete(key interface{}) error                    //delete session value
+    Rename(oldKey, newKey interface{}) error         //move value to newKey, overwriting it, no-op if oldKey is absent
+    KeyModifiedAt(key interface{}) (time.Time, bool) //time value was last set, false if absent
+    SetTransient(key, value interface{})             //set a value for this request only, never stored
+    Begin() (view Session, commit func() error)      //snapshot view buffering writes until commit, see NewView
+    SessionID() string                               //back current sessionID
 }
 
 
 var provides = make(map[string]Provider)
 
+// reserved session keys used by the manager
+const (
+    reservedPrefix = "_session_"
+    keyCreatedAt   = "_session_created_at"  // unix time the session was created
+    keyAccessedAt  = "_session_accessed_at" // unix time the session was last started
+    keyUserID      = "_session_user_id"     // id of the authenticated user
+)
+
+// check whether key is reserved by the manager
+func isReserved(key interface{}) bool {
+    k, ok := key.(string)
+    return ok && strings.HasPrefix(k, reservedPrefix)
+}
+
+// Snapshotter is implemented by sessions which can list their values.
+// Snapshot returns a copy, changing it does not change the session
+type Snapshotter interface {
+    Snapshot() map[interface{}]interface{}
+}
+
+// returned by features which need the values of a session that isn't a Snapshotter
+var errNoSnapshot = errors.New("session: session can't list its values")
+
 //register make a sesscion provider available by the provided name
 func Register(name string, provider Provider) {
     if provider == nil {
@@ -50,92 +82,483 @@ type Manager struct {
     cookieName string  // private cookie name
     lock sync.Mutex
     provider Provider 
+    fallback Provider
     maxlifetime int64
+    beforeWriteCookie func(c *http.Cookie, r *http.Request)
+    absoluteTimeout time.Duration
+    now func() time.Time
+    latency latencyStats
+    apiNoAutoCreate bool
+    allowedHosts map[string]bool
+    apiOnInvalidToken func(r *http.Request) ApiAction
+    hashStoreKeys bool
+    random io.Reader // source of session ids
+    cookieNameSuffix string
+    retryAttempts int
+    retryBackoff time.Duration
+    codec Codec
+    failOpen bool
+    secureMode SecureMode
+    sameSite http.SameSite
+    unauthorizedHeader http.Header
+    unauthorizedBody []byte
+    transportSelector func(r *http.Request) Transport
+    tokenSources []TokenSource
+    idValidator func(sid string) bool
+    gcCollected uint64 // atomic
+    maxKeys int
+    maxBytes int
+    onDestroy func(sid string, values map[interface{}]interface{})
+    migrations []Migration
+    rollingNonce bool
+    skipMethods map[string]bool // nil means only OPTIONS
+    churn churnCounter
+    churnAlertRate float64
+    churnAlert func()
+    churnAlerted bool
+    newSessionHeader string
+    serializeWrites bool
+    writeLocks sidLocks
+    deviceResolver func(r *http.Request) DeviceInfo
+    externalMinLen int
+    externalAlphabet string
+    onIPChange func(s Session, oldIP, newIP string)
+    requireTLS bool
 }
 
-func NewManager(provideName string, cookieName string, maxlifetime int64) (*Manager, error) {
+// Option configure a Manager at creation time
+type Option func(*Manager)
+
+// use p when the named provider is not registered, instead of failing
+func WithFallbackProvider(p Provider) Option {
+    return func(manager *Manager) {
+        manager.fallback = p
+    }
+}
+
+func NewManager(provideName string, cookieName string, maxlifetime int64, opts ...Option) (*Manager, error) {
+    manager := &Manager{cookieName: cookieName, maxlifetime: maxlifetime, now: time.Now, random: rand.Reader, codec: GobCodec{}}
+    for _, opt := range opts {
+        opt(manager)
+    }
+    if err := validateCookieFlags(manager.secureMode, manager.sameSite); err != nil {
+        return nil, err
+    }
     provider, ok := provides[provideName]
     log.Info("new session manager")
     if !ok {
-        log.Error("no valid provider ,error")
-        return nil, fmt.Errorf("session: unknown provide %q (forgotten import?)", provideName)
+        if manager.fallback == nil {
+            log.Error("no valid provider ,error")
+            return nil, fmt.Errorf("session: unknown provide %q (forgotten import?)", provideName)
+        }
+        log.Warnf("session: unknown provide %q, use fallback provider", provideName)
+        provider = manager.fallback
     }
-    return &Manager{provider: provider, cookieName: cookieName, maxlifetime: maxlifetime}, nil
+    manager.provider = provider
+    manager.watchGC()
+    manager.watchExpiry()
+    return manager, nil
+}
+
+// set the clock used for session timestamps, default is time.Now
+func (manager *Manager) SetClock(now func() time.Time) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.now = now
+}
+
+// set the max age of a session counted from its creation, regardless of activity.
+// SessionStart destroys and re-creates older sessions, 0 disables the check
+func (manager *Manager) SetAbsoluteTimeout(d time.Duration) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.absoluteTimeout = d
 }
 
+// set a suffix appended to the cookie name for both reads and writes,
+// e.g. to keep dev and prod cookies apart on one host
+func (manager *Manager) SetCookieNameSuffix(suffix string) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.cookieNameSuffix = suffix
+}
+
+// the cookie name with suffix
+func (manager *Manager) cookieNameInUse() string {
+    return manager.cookieName + manager.cookieNameSuffix
+}
+
+// names of every cookie the manager may have set for a session: the cookie
+// in use, the unsuffixed one from before SetCookieNameSuffix, and their nonce cookies
+func (manager *Manager) cookieVariants() []string {
+    names := []string{manager.cookieNameInUse()}
+    if manager.cookieNameSuffix != "" {
+        names = append(names, manager.cookieName)
+    }
+    if manager.rollingNonce {
+        for _, name := range names[:len(names):len(names)] {
+            names = append(names, name+nonceCookieSuffix)
+        }
+    }
+    return names
+}
+
+// set a callback invoked with the session cookie just before it is written,
+// the callback may modify the cookie. r is nil when called from SessionEnd or BindCookie
+func (manager *Manager) SetBeforeWriteCookie(f func(c *http.Cookie, r *http.Request)) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.beforeWriteCookie = f
+}
+
+// write cookie to response, give the callback a chance to change it first
+func (manager *Manager) writeCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie) {
+    if manager.beforeWriteCookie != nil {
+        manager.beforeWriteCookie(cookie, r)
+    }
+    if !headersWritable(w, "cookie "+cookie.Name) {
+        return
+    }
+    http.SetCookie(w, cookie)
+}
+
+// returned by SessionInit when a session with the sid already exists
+var ErrSIDCollision = errors.New("session: session id already exists")
+
+// times a colliding sid is regenerated before giving up
+const maxSIDAttempts = 3
+
 // get unique global session id
 func (manager *Manager) sessionId() string {
     b := make([]byte, 32)
-    if _, err := io.ReadFull(rand.Reader, b); err != nil {
+    if _, err := io.ReadFull(manager.random, b); err != nil {
         return ""
     }
     return base64.URLEncoding.EncodeToString(b)
 }
 
+// SessionStart return the session of r, creating one and sending its sid when
+// r has none. it returns nil when SetRequireTLS refuses a plain http request
 func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (session Session) {
     manager.lock.Lock()
     defer manager.lock.Unlock()
-    cookie, err := r.Cookie(manager.cookieName)
-    if err != nil || cookie.Value == "" {
-        log.Debug("no valid session id in request cookie, create one")
-        sid := manager.sessionId()
-        log.Debug("new created sid is ", sid)
-        session, _ = manager.provider.SessionInit(sid)
-        cookie := http.Cookie{Name: manager.cookieName, Value: url.QueryEscape(sid), Path: "/", HttpOnly: true, MaxAge: int(manager.maxlifetime)}
-        http.SetCookie(w, &cookie)
+    if !manager.tlsOK(r) {
+        return nil
+    }
+    transport := manager.transportFor(r)
+    if manager.tokenSources != nil {
+        if session, _ = manager.sourceSession(r); session == nil {
+            log.Debug("no token source resolves to a session, create one")
+            return manager.newSession(w, r)
+        }
     } else {
-        sid, _ := url.QueryUnescape(cookie.Value)
-        log.Debugf("get valid session id  %s in request cookie %s\n", sid, manager.cookieName)        
-        session, _ = manager.provider.SessionRead(sid)
+        sid := manager.transportSID(r, transport)
+        if sid == "" {
+            log.Debug("no valid session id in request, create one")
+            return manager.newSession(w, r)
+        }
+
+        log.Debugf("get valid session id  %s in request\n", sid)        
+        var err error
+        session, err = manager.sessionRead(r.Context(), sid)
+        if err != nil {
+            log.Errorf("read session for id %s failed: %v", manager.redactSID(sid), err)
+            return manager.degradedSession(sid)
+        }
+    }
+    if session != nil && manager.dropRevoked(session) {
+        return manager.newSession(w, r)
+    }
+    if session != nil && manager.tooOld(session) {
+        log.Infof("session %s exceeds absolute timeout, re-create it", manager.redactSID(session.SessionID()))
+        return manager.replaceSession(w, r, session)
+    }
+    if session != nil && manager.rollingNonce && transport == Cookie && !manager.checkNonce(w, r, session) {
+        log.Warnf("session %s presented an outdated nonce, cookie may be cloned", manager.redactSID(session.SessionID()))
+        return manager.replaceSession(w, r, session)
+    }
+    if session != nil {
+        manager.touch(session)
+        manager.recordTransport(session, transport)
+        manager.checkIP(session, r)
+    }
+
+    return session
+}
+
+// set the hosts SessionStart may write a session cookie for. requests for other
+// hosts get a transient session which is not stored and has no cookie.
+// an empty list allows every host
+func (manager *Manager) SetAllowedHosts(hosts []string) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    if len(hosts) == 0 {
+        manager.allowedHosts = nil
+        return
+    }
+    manager.allowedHosts = make(map[string]bool, len(hosts))
+    for _, h := range hosts {
+        manager.allowedHosts[strings.ToLower(h)] = true
+    }
+}
+
+// check the request host against the allowlist, with or without port
+func (manager *Manager) hostAllowed(r *http.Request) bool {
+    if manager.allowedHosts == nil {
+        return true
+    }
+    host := strings.ToLower(r.Host)
+    if manager.allowedHosts[host] {
+        return true
     }
+    if h, _, err := net.SplitHostPort(host); err == nil {
+        return manager.allowedHosts[h]
+    }
+    return false
+}
 
+// create a session and write its cookie, caller must hold the lock
+func (manager *Manager) newSession(w http.ResponseWriter, r *http.Request) Session {
+    if !manager.hostAllowed(r) {
+        log.Warnf("host %q is not allowed, no session cookie written", r.Host)
+        return newTransientSession(manager.sessionId())
+    }
+    session, err := manager.createSession(r.Context())
+    if err != nil {
+        log.Errorf("init session failed: %v", err)
+        return manager.degradedSession(manager.sessionId())
+    }
+    manager.bindNew(w, r, session)
+    if manager.newSessionHeader != "" {
+        w.Header().Set(manager.newSessionHeader, "1")
+    }
     return session
 }
 
+// stamp a just created session with the request details and send its sid
+// over the transport of r, caller must hold the lock
+func (manager *Manager) bindNew(w http.ResponseWriter, r *http.Request, session Session) {
+    manager.recordDevice(session, r)
+    manager.checkIP(session, r)
+    manager.applyLifetime(session, r)
+    transport := manager.transportFor(r)
+    manager.recordTransport(session, transport)
+    manager.emitSID(w, r, transport, session)
+    if manager.rollingNonce && transport == Cookie {
+        manager.issueNonce(w, r, session)
+    }
+}
+
+// destroy session and start a new one in its place, caller must hold the lock
+func (manager *Manager) replaceSession(w http.ResponseWriter, r *http.Request, session Session) Session {
+    sid := session.SessionID()
+    manager.notifyDestroy(session)
+    if err := manager.sessionDestroy(sid); err != nil {
+        log.Errorf("destroy session for id %s failed\n", manager.redactSID(sid))
+    }
+    return manager.newSession(w, manager.keepLifetime(r, session))
+}
+
+// build the cookie carrying sid in response to r with the current settings
+// and a MaxAge of lifetime, r may be nil
+func (manager *Manager) sessionCookie(r *http.Request, sid string, lifetime int64) *http.Cookie {
+    return &http.Cookie{Name: manager.cookieNameInUse(), Value: url.QueryEscape(sid), Path: "/", HttpOnly: true, MaxAge: int(lifetime),
+        Secure: manager.cookieSecure(r), SameSite: manager.sameSite}
+}
+
+// BindCookie (re)write the cookie for s without touching the store,
+// e.g. after a session was changed outside of the request
+func (manager *Manager) BindCookie(w http.ResponseWriter, s Session) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.writeCookie(w, nil, manager.sessionCookie(nil, s.SessionID(), manager.cookieLifetime(s, nil)))
+}
+
+// init session with a fresh sid in provider and stamp its creation time,
+// the sid is regenerated if it collides with an existing session
+func (manager *Manager) createSession(ctx context.Context) (Session, error) {
+    var session Session
+    var err error
+    for i := 0; i < maxSIDAttempts; i++ {
+        sid := manager.sessionId()
+        if sid == "" {
+            return nil, errors.New("session: can't generate session id")
+        }
+        log.Debug("new created sid is ", sid)
+        session, err = manager.sessionInit(ctx, sid)
+        if !errors.Is(err, ErrSIDCollision) {
+            break
+        }
+        log.Warnf("session id %s collides, generate another one", manager.redactSID(sid))
+    }
+    if err != nil {
+        return nil, err
+    }
+    now := manager.now().Unix()
+    session.Set(keyCreatedAt, now)
+    session.Set(keyAccessedAt, now)
+    if manager.migrations != nil {
+        session.Set(keyVersion, int64(len(manager.migrations)))
+    }
+    manager.recordChurn()
+    return session, nil
+}
+
+// record the access time of the session
+func (manager *Manager) touch(session Session) {
+    session.Set(keyAccessedAt, manager.now().Unix())
+}
+
+// check whether the session is older than the absolute timeout.
+// sessions without a creation time are stamped now
+func (manager *Manager) tooOld(session Session) bool {
+    created, ok := session.Get(keyCreatedAt).(int64)
+    if !ok {
+        session.Set(keyCreatedAt, manager.now().Unix())
+        return false
+    }
+    if manager.absoluteTimeout <= 0 {
+        return false
+    }
+    return manager.now().Sub(time.Unix(created, 0)) > manager.absoluteTimeout
+}
+
 
 func (manager *Manager) SessionEnd(w http.ResponseWriter, s Session) {
     manager.lock.Lock()
     defer manager.lock.Unlock()
     sid := s.SessionID()
-    // delete cookie now, set max age to < 0 value
-    cookie := http.Cookie{Name: manager.cookieName, Value: url.QueryEscape(sid), Path: "/", HttpOnly: true, MaxAge: -1}
-    http.SetCookie(w, &cookie)
+    if t, _ := s.Get(keyTransport).(int64); Transport(t) != Header {
+        // delete cookies now, set max age to < 0 value
+        for _, name := range manager.cookieVariants() {
+            cookie := manager.sessionCookie(nil, "", -1)
+            cookie.Name = name
+            manager.writeCookie(w, nil, cookie)
+        }
+    }
 
     log.Debugf("destroy session for id %s \n", sid) 
-    err := manager.provider.SessionDestroy(sid)
+    manager.notifyDestroy(s)
+    err := manager.sessionDestroy(sid)
     if err != nil {
         log.Errorf("destroy session for id %s failed\n", sid)
     }
 }
 
 
+// set whether ApiSessionStart creates a session when the request carries no token,
+// default is true. when disabled a missing token returns (nil, nil)
+func (manager *Manager) SetApiAutoCreate(create bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.apiNoAutoCreate = !create
+}
+
+// ApiAction tell ApiSessionStart what to do with a token that doesn't resolve
+type ApiAction int
+
+const (
+    CreateNew ApiAction = iota // start a fresh session
+    ReturnNil                  // return (nil, nil)
+    Error                      // return ErrInvalidToken
+)
+
+// returned by ApiSessionStart for an unresolved token when the hook asks for Error
+var ErrInvalidToken = errors.New("session: invalid session token")
+
+// set a hook consulted by ApiSessionStart when the provided token doesn't
+// resolve: SessionRead fails, or the provider made up a session for an unknown sid.
+// without a hook the session returned by the provider is used as before
+func (manager *Manager) SetApiOnInvalidToken(f func(r *http.Request) ApiAction) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.apiOnInvalidToken = f
+}
+
 // start session for json api
-func (manager *Manager) ApiSessionStart(r *http.Request) (session Session) {
+func (manager *Manager) ApiSessionStart(r *http.Request) (session Session, err error) {
+
+    manager.lock.Lock()
+    if !manager.tlsOK(r) {
+        manager.lock.Unlock()
+        return nil, ErrTLSRequired
+    }
+    useSources := manager.tokenSources != nil
+    if useSources {
+        var done bool
+        if session, done, err = manager.apiFromSources(r); done {
+            manager.lock.Unlock()
+            return session, err
+        }
+    }
 
-    sid := r.Header.Get("X-Session-Token")
-    log.Debugf("get session token is %s", sid)
-    sid, _ = url.QueryUnescape(sid)        
+    var sid string
+    if !useSources {
+        sid = r.Header.Get(tokenHeader)
+        log.Debugf("get session token is %s", sid)
+        sid, _ = url.QueryUnescape(sid)        
+        sid = manager.checkSID(sid)
+    }
+    manager.lock.Unlock()
 
 
     if sid == "" {
+        manager.lock.Lock()
+        noCreate := manager.apiNoAutoCreate
+        manager.lock.Unlock()
+        if noCreate {
+            log.Debug("no valid session id in request, auto create disabled")
+            return nil, nil
+        }
         log.Debug("no valid session id in request, create one")
         session = manager.ApiSessionCreate()
     } else {
         manager.lock.Lock()
         defer manager.lock.Unlock()        
         //log.Debugf("get valid session id  %s", sid)        
-        session, _ = manager.provider.SessionRead(sid)
+        session, err = manager.sessionRead(r.Context(), sid)
+        if err == nil && session != nil && manager.dropRevoked(session) {
+            if manager.apiOnInvalidToken != nil {
+                return manager.apiInvalidToken(r)
+            }
+            if manager.apiNoAutoCreate {
+                return nil, nil
+            }
+            return manager.createSession(r.Context())
+        }
+        if manager.apiOnInvalidToken != nil && (err != nil || session == nil || session.Get(keyCreatedAt) == nil) {
+            log.Debugf("session token %s doesn't resolve: %v", sid, err)
+            if err == nil {
+                // drop the session the provider created for the unknown sid
+                if err := manager.sessionDestroy(sid); err != nil {
+                    log.Errorf("destroy session for id %s failed\n", manager.redactSID(sid))
+                }
+            }
+            return manager.apiInvalidToken(r)
+        }
+        if err == nil && session != nil {
+            manager.touch(session)
+        }
     }
-    return session
+    return session, err
+}
+
+// apply the invalid token hook, caller must hold the lock
+func (manager *Manager) apiInvalidToken(r *http.Request) (Session, error) {
+    switch manager.apiOnInvalidToken(r) {
+    case ReturnNil:
+        return nil, nil
+    case Error:
+        return nil, ErrInvalidToken
+    }
+    return manager.createSession(r.Context())
 }
 
 func (manager *Manager) ApiSessionCreate() (session Session) {
     manager.lock.Lock()
     defer manager.lock.Unlock()
 
-    sid := manager.sessionId()
-    log.Debug("new created sid is ", sid)
-    session, _ = manager.provider.SessionInit(sid)
+    session, _ = manager.createSession(context.Background())
     return session
 }
 
@@ -148,7 +571,8 @@ func (manager *Manager) ApiSessionEnd(session Session) {
     sid := session.SessionID()
 
     log.Debugf("destroy session for id %s \n", sid) 
-    err := manager.provider.SessionDestroy(sid)
+    manager.notifyDestroy(session)
+    err := manager.sessionDestroy(sid)
     if err != nil {
         log.Errorf("destroy session for id %s failed\n", sid)
     }
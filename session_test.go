@@ -0,0 +1,508 @@
+package session
+
+import (
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+    log "github.com/cihub/seelog"
+)
+
+// fakeProvider keep sessions in a map for the manager tests. like the bundled
+// providers SessionRead creates a missing session, its sessions are Snapshotters
+type fakeProvider struct {
+    lock     sync.Mutex
+    sessions map[string]*fakeSession
+    readErr  error // returned by SessionRead while set
+    reads    int
+}
+
+func newFakeProvider() *fakeProvider {
+    return &fakeProvider{sessions: make(map[string]*fakeSession)}
+}
+
+func (p *fakeProvider) SessionInit(sid string) (Session, error) {
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    if _, ok := p.sessions[sid]; ok {
+        return nil, ErrSIDCollision
+    }
+    st := &fakeSession{sid: sid, value: make(map[interface{}]interface{}), modified: make(map[interface{}]time.Time)}
+    p.sessions[sid] = st
+    return st, nil
+}
+
+func (p *fakeProvider) SessionRead(sid string) (Session, error) {
+    p.lock.Lock()
+    p.reads++
+    err, st := p.readErr, p.sessions[sid]
+    p.lock.Unlock()
+    if err != nil {
+        return nil, err
+    }
+    if st == nil {
+        return p.SessionInit(sid)
+    }
+    return st, nil
+}
+
+func (p *fakeProvider) SessionDestroy(sid string) error {
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    delete(p.sessions, sid)
+    return nil
+}
+
+func (p *fakeProvider) SessionGC(maxlifetime int64) {}
+
+// stored session of sid, nil if there is none
+func (p *fakeProvider) stored(sid string) *fakeSession {
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    return p.sessions[sid]
+}
+
+type fakeSession struct {
+    lock      sync.Mutex
+    sid       string
+    value     map[interface{}]interface{}
+    modified  map[interface{}]time.Time
+    transient map[interface{}]interface{}
+}
+
+func (st *fakeSession) Set(key, value interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    delete(st.transient, key)
+    st.value[key] = value
+    st.modified[key] = time.Now()
+    return nil
+}
+
+func (st *fakeSession) Get(key interface{}) interface{} {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if v, ok := st.transient[key]; ok {
+        return v
+    }
+    return st.value[key]
+}
+
+func (st *fakeSession) Delete(key interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    delete(st.transient, key)
+    delete(st.value, key)
+    delete(st.modified, key)
+    return nil
+}
+
+func (st *fakeSession) Rename(oldKey, newKey interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    v, ok := st.value[oldKey]
+    if !ok {
+        return nil
+    }
+    delete(st.value, oldKey)
+    delete(st.modified, oldKey)
+    st.value[newKey] = v
+    st.modified[newKey] = time.Now()
+    return nil
+}
+
+func (st *fakeSession) KeyModifiedAt(key interface{}) (time.Time, bool) {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    t, ok := st.modified[key]
+    return t, ok
+}
+
+func (st *fakeSession) SetTransient(key, value interface{}) {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if st.transient == nil {
+        st.transient = make(map[interface{}]interface{})
+    }
+    st.transient[key] = value
+}
+
+func (st *fakeSession) Begin() (Session, func() error) {
+    return NewView(st)
+}
+
+func (st *fakeSession) SessionID() string {
+    return st.sid
+}
+
+func (st *fakeSession) Snapshot() map[interface{}]interface{} {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    values := make(map[interface{}]interface{}, len(st.value))
+    for k, v := range st.value {
+        values[k] = v
+    }
+    return values
+}
+
+// manager on a fresh fakeProvider, with cookie name "sid" and a lifetime of an hour
+func newTestManager(t *testing.T, opts ...Option) (*Manager, *fakeProvider) {
+    t.Helper()
+    p := newFakeProvider()
+    manager, err := NewManager("test", "sid", 3600, append(opts, WithFallbackProvider(p))...)
+    if err != nil {
+        t.Fatalf("NewManager: %v", err)
+    }
+    t.Cleanup(manager.Close)
+    return manager, p
+}
+
+// cookie named name set by the response, nil if there is none
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+    for _, c := range rec.Result().Cookies() {
+        if c.Name == name {
+            return c
+        }
+    }
+    return nil
+}
+
+// request for / sending cookies
+func requestWith(cookies ...*http.Cookie) *http.Request {
+    r := httptest.NewRequest("GET", "/", nil)
+    for _, c := range cookies {
+        r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+    }
+    return r
+}
+
+// start a session for a request without cookies, return it with its cookie
+func startNew(t *testing.T, manager *Manager) (Session, *http.Cookie) {
+    t.Helper()
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, requestWith())
+    if s == nil {
+        t.Fatal("SessionStart returned nil")
+    }
+    c := responseCookie(rec, manager.cookieNameInUse())
+    if c == nil {
+        t.Fatal("SessionStart wrote no session cookie")
+    }
+    return s, c
+}
+
+func TestBeforeWriteCookie(t *testing.T) {
+    manager, _ := newTestManager(t)
+    var requests []*http.Request
+    manager.SetBeforeWriteCookie(func(c *http.Cookie, r *http.Request) {
+        c.Domain = "example.com"
+        requests = append(requests, r)
+    })
+
+    s, c := startNew(t, manager)
+    if c.Domain != "example.com" {
+        t.Fatalf("cookie domain = %q, want the one set by the callback", c.Domain)
+    }
+    if len(requests) != 1 || requests[0] == nil {
+        t.Fatalf("callback got requests %v, want the one of SessionStart", requests)
+    }
+
+    rec := httptest.NewRecorder()
+    manager.SessionEnd(rec, s)
+    end := responseCookie(rec, "sid")
+    if end == nil || end.Domain != "example.com" {
+        t.Fatalf("SessionEnd cookie = %v, want it changed by the callback", end)
+    }
+    if len(requests) != 2 || requests[1] != nil {
+        t.Fatalf("callback got requests %v, want nil from SessionEnd", requests)
+    }
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+    manager, p := newTestManager(t)
+    now := time.Unix(1700000000, 0)
+    manager.SetClock(func() time.Time { return now })
+    manager.SetAbsoluteTimeout(time.Hour)
+
+    s, c := startNew(t, manager)
+    now = now.Add(50 * time.Minute)
+    if got := manager.SessionStart(httptest.NewRecorder(), requestWith(c)); got.SessionID() != s.SessionID() {
+        t.Fatalf("session within the timeout was replaced by %s", got.SessionID())
+    }
+
+    now = now.Add(20 * time.Minute)
+    rec := httptest.NewRecorder()
+    got := manager.SessionStart(rec, requestWith(c))
+    if got.SessionID() == s.SessionID() {
+        t.Fatal("session past the absolute timeout was kept")
+    }
+    if p.stored(s.SessionID()) != nil {
+        t.Fatal("session past the absolute timeout was not destroyed")
+    }
+    if c := responseCookie(rec, "sid"); c == nil || c.Value == "" {
+        t.Fatal("no cookie written for the replacing session")
+    }
+}
+
+// logBuffer collect what the package logs, safe for the manager's goroutines
+type logBuffer struct {
+    lock sync.Mutex
+    buf  bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+    return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+    return b.buf.String()
+}
+
+// send the log at Info and above to the returned buffer for the rest of the
+// test, one "LEVEL message" line per entry
+func captureLog(t *testing.T) *logBuffer {
+    t.Helper()
+    buf := &logBuffer{}
+    logger, err := log.LoggerFromWriterWithMinLevelAndFormat(buf, log.InfoLvl, "%LEVEL %Msg%n")
+    if err != nil {
+        t.Fatalf("create logger: %v", err)
+    }
+    old := log.Current
+    log.UseLogger(logger)
+    t.Cleanup(func() { log.UseLogger(old) })
+    return buf
+}
+
+func TestFallbackProvider(t *testing.T) {
+    if _, err := NewManager("test-unknown", "sid", 3600); err == nil {
+        t.Fatal("NewManager with an unknown provider and no fallback succeeded")
+    }
+
+    logged := captureLog(t)
+    p := newFakeProvider()
+    manager, err := NewManager("test-unknown", "sid", 3600, WithFallbackProvider(p))
+    if err != nil {
+        t.Fatalf("NewManager with a fallback: %v", err)
+    }
+    defer manager.Close()
+    if manager.provider != Provider(p) {
+        t.Fatal("unknown provider name did not use the fallback")
+    }
+    if !strings.Contains(logged.String(), `WARN session: unknown provide "test-unknown", use fallback provider`) {
+        t.Fatalf("no warning about the fallback, logged:\n%s", logged)
+    }
+
+    name := "test-fallback-registered"
+    registered := newFakeProvider()
+    Register(name, registered)
+    t.Cleanup(func() { delete(provides, name) })
+    manager, err = NewManager(name, "sid", 3600, WithFallbackProvider(p))
+    if err != nil {
+        t.Fatalf("NewManager: %v", err)
+    }
+    defer manager.Close()
+    if manager.provider != Provider(registered) {
+        t.Fatal("fallback replaced a registered provider")
+    }
+    if strings.Count(logged.String(), "use fallback provider") != 1 {
+        t.Fatalf("warned about the fallback for a registered provider, logged:\n%s", logged)
+    }
+}
+
+// api request carrying sid in the token header
+func apiRequest(sid string) *http.Request {
+    r := httptest.NewRequest("GET", "/", nil)
+    if sid != "" {
+        r.Header.Set(tokenHeader, url.QueryEscape(sid))
+    }
+    return r
+}
+
+func TestApiAutoCreate(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, err := manager.ApiSessionStart(apiRequest(""))
+    if err != nil || s == nil {
+        t.Fatalf("ApiSessionStart without token = %v, %v, want a new session", s, err)
+    }
+
+    manager.SetApiAutoCreate(false)
+    if s, err := manager.ApiSessionStart(apiRequest("")); s != nil || err != nil {
+        t.Fatalf("ApiSessionStart without token and auto create off = %v, %v, want nil, nil", s, err)
+    }
+    got, err := manager.ApiSessionStart(apiRequest(s.SessionID()))
+    if err != nil || got == nil || got.SessionID() != s.SessionID() {
+        t.Fatalf("ApiSessionStart with a token = %v, %v, want the session of the token", got, err)
+    }
+}
+
+func TestAllowedHosts(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetAllowedHosts([]string{"Example.com"})
+
+    for _, host := range []string{"example.com", "EXAMPLE.com:8080"} {
+        r := requestWith()
+        r.Host = host
+        rec := httptest.NewRecorder()
+        s := manager.SessionStart(rec, r)
+        if responseCookie(rec, "sid") == nil || p.stored(s.SessionID()) == nil {
+            t.Errorf("host %s: no stored session with a cookie", host)
+        }
+    }
+
+    r := requestWith()
+    r.Host = "evil.com"
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, r)
+    if _, ok := s.(*transientSession); !ok {
+        t.Fatalf("session for a foreign host is %T, want a transient one", s)
+    }
+    if responseCookie(rec, "sid") != nil || p.stored(s.SessionID()) != nil {
+        t.Fatal("session for a foreign host was stored or got a cookie")
+    }
+
+    manager.SetAllowedHosts(nil)
+    rec = httptest.NewRecorder()
+    manager.SessionStart(rec, r)
+    if responseCookie(rec, "sid") == nil {
+        t.Fatal("empty allowlist still refused a host")
+    }
+}
+
+func TestApiOnInvalidToken(t *testing.T) {
+    cases := []struct {
+        action ApiAction
+        err    error
+        create bool
+    }{
+        {ReturnNil, nil, false},
+        {Error, ErrInvalidToken, false},
+        {CreateNew, nil, true},
+    }
+    for _, c := range cases {
+        manager, p := newTestManager(t)
+        manager.SetApiOnInvalidToken(func(r *http.Request) ApiAction { return c.action })
+        unknown := manager.sessionId()
+        s, err := manager.ApiSessionStart(apiRequest(unknown))
+        if err != c.err || (s != nil) != c.create {
+            t.Errorf("action %d: ApiSessionStart = %v, %v", c.action, s, err)
+        }
+        if s != nil && s.SessionID() == unknown {
+            t.Errorf("action %d: the session took the unknown sid", c.action)
+        }
+        if p.stored(unknown) != nil {
+            t.Errorf("action %d: the session made up for the unknown sid was kept", c.action)
+        }
+    }
+
+    manager, _ := newTestManager(t)
+    manager.SetApiOnInvalidToken(func(r *http.Request) ApiAction { return Error })
+    known := manager.ApiSessionCreate()
+    if s, err := manager.ApiSessionStart(apiRequest(known.SessionID())); err != nil || s.SessionID() != known.SessionID() {
+        t.Fatalf("ApiSessionStart with a valid token = %v, %v", s, err)
+    }
+}
+
+func TestBindCookie(t *testing.T) {
+    manager, p := newTestManager(t)
+    s := manager.ApiSessionCreate()
+    reads := p.reads
+
+    rec := httptest.NewRecorder()
+    manager.BindCookie(rec, s)
+    c := responseCookie(rec, "sid")
+    if c == nil || c.MaxAge != 3600 || !c.HttpOnly {
+        t.Fatalf("BindCookie wrote %v, want the session cookie", c)
+    }
+    if p.reads != reads {
+        t.Fatal("BindCookie read the store")
+    }
+    if got := manager.SessionStart(httptest.NewRecorder(), requestWith(c)); got.SessionID() != s.SessionID() {
+        t.Fatalf("cookie from BindCookie resumed %s, want %s", got.SessionID(), s.SessionID())
+    }
+}
+
+// reader returning zero bytes forever, every sid drawn from it is the same
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+    for i := range b {
+        b[i] = 0
+    }
+    return len(b), nil
+}
+
+func TestSIDCollisionRegenerates(t *testing.T) {
+    first, p := newTestManager(t)
+    second, err := NewManager("test", "sid", 3600, WithFallbackProvider(p))
+    if err != nil {
+        t.Fatalf("NewManager: %v", err)
+    }
+    defer second.Close()
+    first.SetTestSeed(1)
+    second.SetTestSeed(1)
+
+    a := first.ApiSessionCreate()
+    b := second.ApiSessionCreate()
+    if b == nil || b.SessionID() == a.SessionID() {
+        t.Fatalf("colliding sid was not regenerated: %v and %v", a, b)
+    }
+    if p.stored(a.SessionID()) == nil || p.stored(b.SessionID()) == nil {
+        t.Fatal("a session was lost to the collision")
+    }
+
+    first.random, second.random = zeroReader{}, zeroReader{}
+    first.ApiSessionCreate()
+    if s := second.ApiSessionCreate(); s != nil {
+        t.Fatalf("ApiSessionCreate = %v, want nil once every attempt collides", s.SessionID())
+    }
+}
+
+func TestCookieNameSuffix(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetCookieNameSuffix("_dev")
+    s, c := startNew(t, manager)
+    if c.Name != "sid_dev" {
+        t.Fatalf("cookie name = %q, want sid_dev", c.Name)
+    }
+    if got := manager.SessionStart(httptest.NewRecorder(), requestWith(c)); got.SessionID() != s.SessionID() {
+        t.Fatal("suffixed cookie did not resume the session")
+    }
+    plain := &http.Cookie{Name: "sid", Value: c.Value}
+    if got := manager.SessionStart(httptest.NewRecorder(), requestWith(plain)); got.SessionID() == s.SessionID() {
+        t.Fatal("cookie without the suffix resumed the session")
+    }
+}
+
+func TestSessionEndClearsEveryCookie(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetCookieNameSuffix("_dev")
+    manager.SetRollingNonce(true)
+    manager.SetBeforeWriteCookie(func(c *http.Cookie, r *http.Request) { c.Domain = "example.com" })
+    s, _ := startNew(t, manager)
+
+    rec := httptest.NewRecorder()
+    manager.SessionEnd(rec, s)
+    cleared := make(map[string]bool)
+    for _, c := range rec.Result().Cookies() {
+        if c.MaxAge >= 0 || c.Value != "" || c.Domain != "example.com" {
+            t.Errorf("cookie %s = %v, want an expired one for example.com", c.Name, c)
+        }
+        cleared[c.Name] = true
+    }
+    for _, name := range []string{"sid_dev", "sid", "sid_dev" + nonceCookieSuffix, "sid" + nonceCookieSuffix} {
+        if !cleared[name] {
+            t.Errorf("SessionEnd didn't clear cookie %s, cleared %v", name, cleared)
+        }
+    }
+    if p.stored(s.SessionID()) != nil {
+        t.Fatal("SessionEnd left the session in the store")
+    }
+}
@@ -0,0 +1,141 @@
+package session
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "time"
+    log "github.com/cihub/seelog"
+)
+
+// set whether providers are keyed on SHA-256(sid) instead of the raw sid,
+// so a dump of the store doesn't reveal valid cookies. the cookie still
+// carries the raw sid. changing it orphans the sessions already stored
+func (manager *Manager) SetHashStoreKeys(hash bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.hashStoreKeys = hash
+}
+
+// key the provider stores sid under
+func (manager *Manager) storeKey(sid string) string {
+    if !manager.hashStoreKeys {
+        return sid
+    }
+    sum := sha256.Sum256([]byte(sid))
+    return hex.EncodeToString(sum[:])
+}
+
+// hashedSession report the raw sid for a session stored under its hash
+type hashedSession struct {
+    Session
+    sid string
+}
+
+func (st *hashedSession) SessionID() string {
+    return st.sid
+}
+
+// the provider session under a session the manager handed out, for the
+// optional session interfaces (Snapshotter, Batcher, ...) which the wrapper
+// doesn't have. the result must not be asked for its SessionID
+func unwrapSession(s Session) Session {
+    if h, ok := s.(*hashedSession); ok {
+        return h.Session
+    }
+    return s
+}
+
+// wrap a session from the provider so it reports the raw sid
+func (manager *Manager) fromStore(sid string, session Session) Session {
+    if session == nil || !manager.hashStoreKeys {
+        return session
+    }
+    return &hashedSession{Session: session, sid: sid}
+}
+
+// SIDError wrap a provider error with an id of the failing session safe to
+// log: the store key with SetHashStoreKeys, otherwise a prefix of the sid.
+// use errors.As to get at it
+type SIDError struct {
+    id  string
+    Err error
+}
+
+func (e *SIDError) Error() string {
+    return fmt.Sprintf("session %s: %v", e.id, e.Err)
+}
+
+func (e *SIDError) Unwrap() error {
+    return e.Err
+}
+
+// ID identify the session the provider failed on, it can't be used as a sid
+func (e *SIDError) ID() string {
+    return e.id
+}
+
+// characters of a sid kept in errors when store keys aren't hashed
+const sidPrefixLen = 6
+
+// id of sid for errors and logs, which doesn't give the session away
+func (manager *Manager) redactSID(sid string) string {
+    if manager.hashStoreKeys {
+        return manager.storeKey(sid)
+    }
+    return RedactKey(sid)
+}
+
+// RedactKey shorten a store key for logs, for providers which may be given
+// raw sids: only the first characters are kept
+func RedactKey(key string) string {
+    if len(key) <= sidPrefixLen {
+        return "..."
+    }
+    return key[:sidPrefixLen] + "..."
+}
+
+func (manager *Manager) wrapSIDError(sid string, err error) error {
+    if err == nil {
+        return nil
+    }
+    return &SIDError{id: manager.redactSID(sid), Err: err}
+}
+
+// the provider calls made by the manager, errors are wrapped in SIDError
+
+func (manager *Manager) sessionInit(ctx context.Context, sid string) (Session, error) {
+    var session Session
+    err := manager.withRetry(ctx, func() (err error) {
+        defer manager.observe("SessionInit", time.Now())
+        session, err = manager.provider.SessionInit(manager.storeKey(sid))
+        return err
+    })
+    return manager.fromStore(sid, session), manager.wrapSIDError(sid, err)
+}
+
+func (manager *Manager) sessionRead(ctx context.Context, sid string) (Session, error) {
+    var session Session
+    err := manager.withRetry(ctx, func() (err error) {
+        defer manager.observe("SessionRead", time.Now())
+        session, err = manager.provider.SessionRead(manager.storeKey(sid))
+        return err
+    })
+    if errors.Is(err, ErrCorrupt) {
+        log.Errorf("session %s is corrupt, recreate it", manager.redactSID(sid))
+        if err = manager.provider.SessionDestroy(manager.storeKey(sid)); err == nil {
+            session, err = manager.provider.SessionRead(manager.storeKey(sid))
+        }
+    }
+    if err == nil && session != nil && manager.migrations != nil {
+        err = manager.migrate(session)
+    }
+    return manager.fromStore(sid, session), manager.wrapSIDError(sid, err)
+}
+
+func (manager *Manager) sessionDestroy(sid string) error {
+    defer manager.observe("SessionDestroy", time.Now())
+    return manager.wrapSIDError(sid, manager.provider.SessionDestroy(manager.storeKey(sid)))
+}
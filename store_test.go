@@ -0,0 +1,135 @@
+package session
+
+import (
+    "context"
+    "errors"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestHashStoreKeys(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetHashStoreKeys(true)
+
+    s, c := startNew(t, manager)
+    sid := s.SessionID()
+    if p.stored(sid) != nil {
+        t.Fatal("session stored under the raw sid")
+    }
+    stored := p.stored(manager.storeKey(sid))
+    if stored == nil {
+        t.Fatal("session not stored under the hashed sid")
+    }
+    if got := manager.SessionStart(httptest.NewRecorder(), requestWith(c)); got.SessionID() != sid {
+        t.Fatalf("resumed session reports sid %q, want the raw %q", got.SessionID(), sid)
+    }
+
+    manager.SessionEnd(httptest.NewRecorder(), s)
+    if p.stored(manager.storeKey(sid)) != nil {
+        t.Fatal("SessionEnd left the hashed session")
+    }
+}
+
+// the optional session interfaces reach the provider session through the wrapper
+func TestHashedSessionInterfaces(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetHashStoreKeys(true)
+    s, _ := startNew(t, manager)
+    s.Set("cart", 3)
+
+    dump, err := manager.DebugDump(s)
+    if err != nil || !strings.Contains(dump, "cart") {
+        t.Fatalf("DebugDump = %q, %v, want the values", dump, err)
+    }
+
+    view, commit := s.Begin()
+    if view.Get("cart") != 3 {
+        t.Fatal("view does not see the values")
+    }
+    view.Set("cart", 4)
+    if err := commit(); err != nil {
+        t.Fatalf("commit: %v", err)
+    }
+    if got := p.stored(manager.storeKey(s.SessionID())).Get("cart"); got != 4 {
+        t.Fatalf("stored cart after commit = %v, want 4", got)
+    }
+
+    present, err := manager.DeleteIfPresent(s, "cart")
+    if err != nil || !present {
+        t.Fatalf("DeleteIfPresent = %v, %v, want true", present, err)
+    }
+    if present, _ := manager.DeleteIfPresent(s, "cart"); present {
+        t.Fatal("DeleteIfPresent of a deleted key reported true")
+    }
+}
+
+func TestSIDErrorKeepsSIDOut(t *testing.T) {
+    for _, hash := range []bool{false, true} {
+        manager, p := newTestManager(t)
+        manager.SetHashStoreKeys(hash)
+        sid := manager.sessionId()
+        p.readErr = errors.New("store down")
+
+        _, err := readWithLock(manager, context.Background(), sid)
+        var sidErr *SIDError
+        if !errors.As(err, &sidErr) || !errors.Is(err, p.readErr) {
+            t.Fatalf("hash %v: read error %v, want a SIDError wrapping the provider error", hash, err)
+        }
+        if strings.Contains(err.Error(), sid) || strings.Contains(sidErr.ID(), sid) {
+            t.Fatalf("hash %v: error %q gives the sid away", hash, err)
+        }
+        want := sid[:sidPrefixLen] + "..."
+        if hash {
+            want = manager.storeKey(sid)
+        }
+        if sidErr.ID() != want {
+            t.Fatalf("hash %v: ID() = %q, want %q", hash, sidErr.ID(), want)
+        }
+    }
+}
+
+// corruptProvider is a fakeProvider failing reads of the sids in corrupt
+// with ErrCorrupt, until they are destroyed
+type corruptProvider struct {
+    *fakeProvider
+    corrupt map[string]bool
+}
+
+func (p *corruptProvider) SessionRead(sid string) (Session, error) {
+    if p.corrupt[sid] {
+        return nil, ErrCorrupt
+    }
+    return p.fakeProvider.SessionRead(sid)
+}
+
+func (p *corruptProvider) SessionDestroy(sid string) error {
+    delete(p.corrupt, sid)
+    return p.fakeProvider.SessionDestroy(sid)
+}
+
+func TestCorruptSessionRecreated(t *testing.T) {
+    p := &corruptProvider{fakeProvider: newFakeProvider(), corrupt: make(map[string]bool)}
+    manager := newManagerOn(t, p)
+    s, c := startNew(t, manager)
+    s.Set("user", "alice")
+    p.corrupt[s.SessionID()] = true
+
+    logged := captureLog(t)
+    got := manager.SessionStart(httptest.NewRecorder(), requestWith(c))
+    if out := logged.String(); strings.Contains(out, s.SessionID()) || !strings.Contains(out, "is corrupt, recreate it") {
+        t.Fatalf("corruption log shows the sid or is missing:\n%s", out)
+    }
+    if got == nil || got.Get("user") != nil {
+        t.Fatalf("corrupt session read as %v, want an empty one", got)
+    }
+    if p.corrupt[s.SessionID()] {
+        t.Fatal("corrupt session wasn't destroyed")
+    }
+
+    // other read errors are not recovered from
+    p.readErr = errors.New("store down")
+    if _, err := manager.Checkout(s.SessionID()); !errors.Is(err, p.readErr) {
+        t.Fatalf("Checkout with the store down = %v, want its error", err)
+    }
+}
@@ -0,0 +1,16 @@
+package session
+
+import (
+    mathrand "math/rand"
+    log "github.com/cihub/seelog"
+)
+
+// SetTestSeed switch session id generation to a math/rand generator seeded
+// with seed, so tests get the same sid sequence on every run.
+// TEST MODE ONLY: such ids are predictable, never call this in production
+func (manager *Manager) SetTestSeed(seed int64) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    log.Critical("session: TEST MODE, session ids are generated from a fixed seed and are NOT secure")
+    manager.random = mathrand.New(mathrand.NewSource(seed))
+}
@@ -0,0 +1,27 @@
+package session
+
+import "testing"
+
+func TestSetTestSeed(t *testing.T) {
+    sids := func(seed int64) []string {
+        manager, _ := newTestManager(t)
+        manager.SetTestSeed(seed)
+        var ids []string
+        for i := 0; i < 3; i++ {
+            ids = append(ids, manager.ApiSessionCreate().SessionID())
+        }
+        return ids
+    }
+    a, b, other := sids(42), sids(42), sids(43)
+    for i := range a {
+        if a[i] != b[i] {
+            t.Fatalf("sid %d differs between runs with the same seed: %s, %s", i, a[i], b[i])
+        }
+        if !ValidSID(a[i]) {
+            t.Fatalf("seeded sid %q is not a valid sid", a[i])
+        }
+    }
+    if a[0] == other[0] {
+        t.Fatal("different seeds gave the same sid")
+    }
+}
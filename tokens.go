@@ -0,0 +1,82 @@
+package session
+
+import (
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// SourceKind tell where in the request a TokenSource looks
+type SourceKind int
+
+const (
+    HeaderSource SourceKind = iota // request header, a "Bearer " prefix is stripped
+    CookieSource                   // cookie
+    QuerySource                    // url query parameter
+)
+
+// TokenSource name one place a session token may be sent in
+type TokenSource struct {
+    Kind SourceKind
+    Name string
+}
+
+// token sent in r at this source, "" if none
+func (src TokenSource) token(r *http.Request) string {
+    var v string
+    switch src.Kind {
+    case HeaderSource:
+        v = r.Header.Get(src.Name)
+        if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+            v = v[7:]
+        }
+    case CookieSource:
+        if cookie, err := r.Cookie(src.Name); err == nil {
+            v = cookie.Value
+        }
+    case QuerySource:
+        return r.URL.Query().Get(src.Name)
+    }
+    v, _ = url.QueryUnescape(v)
+    return v
+}
+
+// set the places SessionStart and ApiSessionStart look for a token, in order.
+// the first token resolving to an existing session wins. nil restores the
+// default of the cookie (or transport) and the X-Session-Token header
+func (manager *Manager) SetTokenSources(sources []TokenSource) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.tokenSources = sources
+}
+
+// first session resolved from the token sources, tried reports whether any
+// token was present at all. caller must hold the lock
+func (manager *Manager) sourceSession(r *http.Request) (session Session, tried bool) {
+    for _, src := range manager.tokenSources {
+        sid := manager.checkSID(src.token(r))
+        if sid == "" {
+            continue
+        }
+        tried = true
+        if session = manager.lookup(r.Context(), sid); session != nil {
+            return session, true
+        }
+    }
+    return nil, tried
+}
+
+// ApiSessionStart over the token sources, done reports whether the result is
+// final or ApiSessionStart should go on as if no token was sent. caller must hold the lock
+func (manager *Manager) apiFromSources(r *http.Request) (session Session, done bool, err error) {
+    session, tried := manager.sourceSession(r)
+    if session != nil {
+        manager.touch(session)
+        return session, true, nil
+    }
+    if tried && manager.apiOnInvalidToken != nil {
+        session, err = manager.apiInvalidToken(r)
+        return session, true, err
+    }
+    return nil, false, nil
+}
@@ -0,0 +1,46 @@
+package session
+
+import (
+    "net/http/httptest"
+    "net/url"
+    "testing"
+)
+
+func TestTokenSources(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetTokenSources([]TokenSource{
+        {Kind: HeaderSource, Name: "Authorization"},
+        {Kind: CookieSource, Name: "sid"},
+        {Kind: QuerySource, Name: "token"},
+    })
+    s := manager.ApiSessionCreate()
+    sid := s.SessionID()
+
+    r := httptest.NewRequest("GET", "/", nil)
+    r.Header.Set("Authorization", "Bearer "+url.QueryEscape(sid))
+    if got, err := manager.ApiSessionStart(r); err != nil || got.SessionID() != sid {
+        t.Fatalf("bearer token resolved to %v, %v", got, err)
+    }
+
+    r = httptest.NewRequest("GET", "/?token="+url.QueryEscape(sid), nil)
+    if got := manager.SessionStart(httptest.NewRecorder(), r); got.SessionID() != sid {
+        t.Fatal("query token did not resolve")
+    }
+
+    // an unknown token in an earlier source falls through to the next one
+    unknown := manager.sessionId()
+    r = httptest.NewRequest("GET", "/?token="+url.QueryEscape(sid), nil)
+    r.Header.Set("Authorization", "Bearer "+url.QueryEscape(unknown))
+    if got := manager.SessionStart(httptest.NewRecorder(), r); got.SessionID() != sid {
+        t.Fatal("later source not tried after an unknown token")
+    }
+    if p.stored(unknown) != nil {
+        t.Fatal("unknown token left a session behind")
+    }
+
+    rec := httptest.NewRecorder()
+    got := manager.SessionStart(rec, httptest.NewRequest("GET", "/", nil))
+    if got.SessionID() == sid || responseCookie(rec, "sid") == nil {
+        t.Fatal("request without tokens did not get a new session")
+    }
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+    "sync"
+    "time"
+)
+
+// transientSession live only in process memory and is never handed to the provider
+type transientSession struct {
+    lock  sync.Mutex
+    sid   string
+    value map[interface{}]interface{}
+    modified map[interface{}]time.Time
+}
+
+// the whole session is request scoped, SetTransient is the same as Set
+func (st *transientSession) SetTransient(key, value interface{}) {
+    st.Set(key, value)
+}
+
+func newTransientSession(sid string) *transientSession {
+    return &transientSession{sid: sid, value: make(map[interface{}]interface{}), modified: make(map[interface{}]time.Time)}
+}
+
+func (st *transientSession) Set(key, value interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    st.value[key] = value
+    st.modified[key] = time.Now()
+    return nil
+}
+
+func (st *transientSession) Get(key interface{}) interface{} {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    return st.value[key]
+}
+
+func (st *transientSession) Delete(key interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    delete(st.value, key)
+    delete(st.modified, key)
+    return nil
+}
+
+func (st *transientSession) Rename(oldKey, newKey interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if v, ok := st.value[oldKey]; ok {
+        delete(st.value, oldKey)
+        delete(st.modified, oldKey)
+        st.value[newKey] = v
+        st.modified[newKey] = time.Now()
+    }
+    return nil
+}
+
+func (st *transientSession) KeyModifiedAt(key interface{}) (time.Time, bool) {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    t, ok := st.modified[key]
+    return t, ok
+}
+
+func (st *transientSession) Snapshot() map[interface{}]interface{} {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    values := make(map[interface{}]interface{}, len(st.value))
+    for k, v := range st.value {
+        values[k] = v
+    }
+    return values
+}
+
+func (st *transientSession) SessionID() string {
+    return st.sid
+}
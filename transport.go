@@ -0,0 +1,77 @@
+package session
+
+import (
+    "net/http"
+    "net/url"
+)
+
+// header carrying the session token for json api and the header transport
+const tokenHeader = "X-Session-Token"
+
+// reserved key remembering the transport a session was last started over
+const keyTransport = "_session_transport"
+
+// Transport tell how the session id travels between client and server
+type Transport int
+
+const (
+    Cookie Transport = iota // session cookie
+    Header                  // X-Session-Token request and response header
+)
+
+// set a function choosing the transport of each request for SessionStart
+// and SessionEnd, by default every request uses the cookie
+func (manager *Manager) SetTransportSelector(f func(r *http.Request) Transport) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.transportSelector = f
+}
+
+func (manager *Manager) transportFor(r *http.Request) Transport {
+    if manager.transportSelector == nil {
+        return Cookie
+    }
+    return manager.transportSelector(r)
+}
+
+// sid sent with r over the transport
+func (manager *Manager) transportSID(r *http.Request, t Transport) string {
+    if t == Header {
+        sid, _ := url.QueryUnescape(r.Header.Get(tokenHeader))
+        return manager.checkSID(sid)
+    }
+    cookie, err := r.Cookie(manager.cookieNameInUse())
+    if err != nil || cookie.Value == "" {
+        return ""
+    }
+    sid, _ := url.QueryUnescape(cookie.Value)
+    return manager.checkSID(sid)
+}
+
+// send the sid of session to the client over the transport
+func (manager *Manager) emitSID(w http.ResponseWriter, r *http.Request, t Transport, session Session) {
+    sid := session.SessionID()
+    if t == Header {
+        if !headersWritable(w, tokenHeader+" header") {
+            return
+        }
+        w.Header().Set(tokenHeader, url.QueryEscape(sid))
+        return
+    }
+    manager.writeCookie(w, r, manager.sessionCookie(r, sid, manager.cookieLifetime(session, r)))
+}
+
+// remember the transport on the session so SessionEnd clears the right one
+func (manager *Manager) recordTransport(session Session, t Transport) {
+    if manager.transportSelector != nil {
+        session.Set(keyTransport, int64(t))
+    }
+}
+
+// set a response header, e.g. "X-New-Session", SessionStart sends with value 1
+// on the request that created the session. empty name, the default, disables it
+func (manager *Manager) SetNewSessionHeader(name string) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.newSessionHeader = name
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+)
+
+// header transport for /api requests, cookie otherwise
+func apiByHeader(r *http.Request) Transport {
+    if strings.HasPrefix(r.URL.Path, "/api") {
+        return Header
+    }
+    return Cookie
+}
+
+func TestHeaderTransport(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetTransportSelector(apiByHeader)
+
+    rec := httptest.NewRecorder()
+    s := manager.SessionStart(rec, httptest.NewRequest("GET", "/api/cart", nil))
+    token := rec.Header().Get(tokenHeader)
+    if token != url.QueryEscape(s.SessionID()) || responseCookie(rec, "sid") != nil {
+        t.Fatalf("header transport sent token %q and cookie %v, want only the token", token, responseCookie(rec, "sid"))
+    }
+
+    r := httptest.NewRequest("GET", "/api/cart", nil)
+    r.Header.Set(tokenHeader, token)
+    if got := manager.SessionStart(httptest.NewRecorder(), r); got.SessionID() != s.SessionID() {
+        t.Fatal("token header did not resume the session")
+    }
+    r = httptest.NewRequest("GET", "/page", nil)
+    r.Header.Set(tokenHeader, token)
+    if got := manager.SessionStart(httptest.NewRecorder(), r); got.SessionID() == s.SessionID() {
+        t.Fatal("token header resumed the session on a cookie transport request")
+    }
+
+    rec = httptest.NewRecorder()
+    manager.SessionEnd(rec, s)
+    if len(rec.Result().Cookies()) != 0 {
+        t.Fatal("SessionEnd of a header session wrote cookies")
+    }
+}
+
+func TestCookieTransportDefault(t *testing.T) {
+    manager, _ := newTestManager(t)
+    rec := httptest.NewRecorder()
+    manager.SessionStart(rec, httptest.NewRequest("GET", "/api/cart", nil))
+    if rec.Header().Get(tokenHeader) != "" || responseCookie(rec, "sid") == nil {
+        t.Fatal("without a selector the session did not go in a cookie")
+    }
+}
+
+func TestNewSessionHeader(t *testing.T) {
+    manager, _ := newTestManager(t)
+    rec := httptest.NewRecorder()
+    manager.SessionStart(rec, requestWith())
+    if got := rec.Header().Get("X-New-Session"); got != "" {
+        t.Fatalf("header sent while disabled: %q", got)
+    }
+
+    manager.SetNewSessionHeader("X-New-Session")
+    rec = httptest.NewRecorder()
+    manager.SessionStart(rec, requestWith())
+    if got := rec.Header().Get("X-New-Session"); got != "1" {
+        t.Fatalf("creating request got header %q, want 1", got)
+    }
+    c := responseCookie(rec, "sid")
+    rec = httptest.NewRecorder()
+    manager.SessionStart(rec, requestWith(c))
+    if got := rec.Header().Get("X-New-Session"); got != "" {
+        t.Fatalf("later request got header %q, want none", got)
+    }
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    log "github.com/cihub/seelog"
+)
+
+// length of a generated sid, 32 random bytes in padded base64
+const sidLen = 44
+
+// set the check every sid sent by a client must pass before it reaches the
+// provider, whatever the transport. a rejected sid is treated as absent.
+// nil restores the default, see ValidSID
+func (manager *Manager) SetIDValidator(f func(sid string) bool) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.idValidator = f
+}
+
+// ValidSID report whether sid looks like one the manager generates:
+// 44 characters of the base64 url alphabet
+func ValidSID(sid string) bool {
+    if len(sid) != sidLen {
+        return false
+    }
+    for i := 0; i < len(sid); i++ {
+        c := sid[i]
+        if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '=') {
+            return false
+        }
+    }
+    return true
+}
+
+// returned by ValidateExternalSID for sids below the external sid policy
+var ErrWeakSID = errors.New("session: session id too weak")
+
+// set the minimum length and the allowed characters of sids coming from
+// clients, checked on top of the validator. it guards a lax custom validator
+// against short or low entropy ids from buggy clients. minLen <= 0 and an
+// empty alphabet disable the respective check
+func (manager *Manager) SetExternalSIDPolicy(minLen int, alphabet string) {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    manager.externalMinLen = minLen
+    manager.externalAlphabet = alphabet
+}
+
+// ValidateExternalSID check sid against the policy of SetExternalSIDPolicy,
+// the error wraps ErrWeakSID and tells why
+func (manager *Manager) ValidateExternalSID(sid string) error {
+    manager.lock.Lock()
+    defer manager.lock.Unlock()
+    return manager.checkExternal(sid)
+}
+
+// caller must hold the lock
+func (manager *Manager) checkExternal(sid string) error {
+    if len(sid) < manager.externalMinLen {
+        return fmt.Errorf("%w: %d characters, want at least %d", ErrWeakSID, len(sid), manager.externalMinLen)
+    }
+    if manager.externalAlphabet != "" {
+        for _, c := range sid {
+            if !strings.ContainsRune(manager.externalAlphabet, c) {
+                return fmt.Errorf("%w: character %q not allowed", ErrWeakSID, c)
+            }
+        }
+    }
+    return nil
+}
+
+// sid if it passes the validator and the external sid policy, "" otherwise
+func (manager *Manager) checkSID(sid string) string {
+    if sid == "" {
+        return ""
+    }
+    valid := manager.idValidator
+    if valid == nil {
+        valid = ValidSID
+    }
+    if !valid(sid) {
+        log.Warnf("reject malformed session id %q", manager.redactSID(sid))
+        return ""
+    }
+    if err := manager.checkExternal(sid); err != nil {
+        log.Warnf("reject session id %q: %v", manager.redactSID(sid), err)
+        return ""
+    }
+    return sid
+}
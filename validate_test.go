@@ -0,0 +1,97 @@
+package session
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestValidSID(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, _ := startNew(t, manager)
+    if !ValidSID(s.SessionID()) {
+        t.Fatalf("generated sid %q is not valid", s.SessionID())
+    }
+    for _, sid := range []string{"", "short", strings.Repeat("a", sidLen-1) + "!", strings.Repeat("a", sidLen+1)} {
+        if ValidSID(sid) {
+            t.Errorf("ValidSID(%q) = true", sid)
+        }
+    }
+}
+
+func TestIDValidator(t *testing.T) {
+    manager, p := newTestManager(t)
+    manager.SetIDValidator(func(sid string) bool { return strings.HasPrefix(sid, "ok-") })
+
+    cookie := func(sid string) Session {
+        return manager.SessionStart(httptest.NewRecorder(), requestWith(&http.Cookie{Name: "sid", Value: sid}))
+    }
+    header := func(sid string) Session {
+        s, err := manager.ApiSessionStart(apiRequest(sid))
+        if err != nil {
+            t.Fatalf("ApiSessionStart %q: %v", sid, err)
+        }
+        return s
+    }
+    for name, start := range map[string]func(string) Session{"cookie": cookie, "header": header} {
+        if s := start("ok-" + name); s.SessionID() != "ok-"+name {
+            t.Errorf("%s: accepted sid replaced by %q", name, s.SessionID())
+        }
+        if s := start("bad-" + name); s.SessionID() == "bad-"+name {
+            t.Errorf("%s: sid rejected by the validator was used", name)
+        }
+        if p.stored("bad-"+name) != nil {
+            t.Errorf("%s: rejected sid reached the provider", name)
+        }
+    }
+
+    manager.SetIDValidator(nil)
+    if s := cookie("ok-cookie"); s.SessionID() == "ok-cookie" {
+        t.Fatal("default validator accepted a malformed sid")
+    }
+}
+
+func TestExternalSIDPolicy(t *testing.T) {
+    manager, _ := newTestManager(t)
+    manager.SetIDValidator(func(sid string) bool { return true })
+    manager.SetExternalSIDPolicy(16, "abcdef0123456789")
+
+    for sid, want := range map[string]string{
+        "abc123":                  "6 characters",
+        "0123456789abcdefXYZ0000": "character 'X'",
+    } {
+        err := manager.ValidateExternalSID(sid)
+        if !errors.Is(err, ErrWeakSID) || !strings.Contains(err.Error(), want) {
+            t.Errorf("ValidateExternalSID(%q) = %v, want ErrWeakSID telling %s", sid, err, want)
+        }
+        s := manager.SessionStart(httptest.NewRecorder(), requestWith(&http.Cookie{Name: "sid", Value: sid}))
+        if s.SessionID() == sid {
+            t.Errorf("weak sid %q accepted from the cookie", sid)
+        }
+    }
+
+    strong := "0123456789abcdef0123"
+    if err := manager.ValidateExternalSID(strong); err != nil {
+        t.Fatalf("ValidateExternalSID(%q) = %v", strong, err)
+    }
+    if s := manager.SessionStart(httptest.NewRecorder(), requestWith(&http.Cookie{Name: "sid", Value: strong})); s.SessionID() != strong {
+        t.Fatalf("sid passing the policy replaced by %q", s.SessionID())
+    }
+
+    manager.SetExternalSIDPolicy(0, "")
+    if err := manager.ValidateExternalSID("x"); err != nil {
+        t.Fatalf("disabled policy rejected a sid: %v", err)
+    }
+}
+
+func TestRejectedSIDRedactedInLog(t *testing.T) {
+    manager, _ := newTestManager(t)
+    logged := captureLog(t)
+    sid := "not-a-valid-session-id"
+    manager.SessionStart(httptest.NewRecorder(), requestWith(&http.Cookie{Name: "sid", Value: sid}))
+    if out := logged.String(); strings.Contains(out, sid) || !strings.Contains(out, "reject malformed session id") {
+        t.Fatalf("rejection log shows the sid or is missing:\n%s", out)
+    }
+}
@@ -0,0 +1,93 @@
+package session
+
+import "time"
+
+// Batcher is implemented by sessions which can apply several changes at
+// once, so no reader sees only part of them
+type Batcher interface {
+    Apply(set map[interface{}]interface{}, deleted []interface{}) error
+}
+
+// apply the changes to s in one step when s is a Batcher, key by key otherwise
+func applyChanges(s Session, set map[interface{}]interface{}, deleted []interface{}) error {
+    s = unwrapSession(s)
+    if b, ok := s.(Batcher); ok {
+        return b.Apply(set, deleted)
+    }
+    for _, k := range deleted {
+        if err := s.Delete(k); err != nil {
+            return err
+        }
+    }
+    for k, v := range set {
+        if err := s.Set(k, v); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// NewView implement Session.Begin for s: the view reads a snapshot of s taken
+// now and buffers writes until commit applies them, at once if s is a Batcher.
+// the view can be used again after commit. reads are isolated only when s is
+// a Snapshotter, otherwise they go to s
+func NewView(s Session) (view Session, commit func() error) {
+    st := newCheckedOut(s)
+    return st, st.commit
+}
+
+func (st *checkedOut) commit() error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    if len(st.set) == 0 && len(st.deleted) == 0 {
+        return nil
+    }
+    if err := applyChanges(st.inner, st.set, st.deletedKeys()); err != nil {
+        return err
+    }
+    st.settle()
+    return nil
+}
+
+func (st *checkedOut) Begin() (Session, func() error) {
+    return NewView(st)
+}
+
+// buffer the changes like Set and Delete do
+func (st *checkedOut) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    for _, k := range deleted {
+        st.delete(k)
+    }
+    for k, v := range set {
+        delete(st.transient, k)
+        st.set[k] = v
+        st.modified[k] = time.Now()
+        delete(st.deleted, k)
+    }
+    return nil
+}
+
+func (st *transientSession) Begin() (Session, func() error) {
+    return NewView(st)
+}
+
+func (st *transientSession) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    st.lock.Lock()
+    defer st.lock.Unlock()
+    for _, k := range deleted {
+        delete(st.value, k)
+        delete(st.modified, k)
+    }
+    now := time.Now()
+    for k, v := range set {
+        st.value[k] = v
+        st.modified[k] = now
+    }
+    return nil
+}
+
+func (st *hashedSession) Begin() (Session, func() error) {
+    return NewView(st)
+}
@@ -0,0 +1,62 @@
+package session
+
+import "testing"
+
+// batchSession count the Apply calls made to a transientSession
+type batchSession struct {
+    *transientSession
+    applies int
+}
+
+func (st *batchSession) Apply(set map[interface{}]interface{}, deleted []interface{}) error {
+    st.applies++
+    return st.transientSession.Apply(set, deleted)
+}
+
+func TestBegin(t *testing.T) {
+    manager, _ := newTestManager(t)
+    s, _ := startNew(t, manager)
+    s.Set("a", 1)
+    s.Set("b", 1)
+
+    view, commit := s.Begin()
+    view.Set("a", 2)
+    view.Delete("b")
+    s.Set("c", 1)
+    if s.Get("a") != 1 || s.Get("b") != 1 {
+        t.Fatal("view changes visible before commit")
+    }
+    if view.Get("c") != nil || view.Get("a") != 2 || view.Get("b") != nil {
+        t.Fatalf("view reads %v, want its snapshot with its own changes", view.(Snapshotter).Snapshot())
+    }
+
+    if err := commit(); err != nil {
+        t.Fatalf("commit: %v", err)
+    }
+    if s.Get("a") != 2 || s.Get("b") != nil || s.Get("c") != 1 {
+        t.Fatalf("session after commit = %v", s.(Snapshotter).Snapshot())
+    }
+
+    // the view stays usable after commit
+    view.Set("d", 1)
+    if err := commit(); err != nil || s.Get("d") != 1 {
+        t.Fatalf("second commit = %v, d = %v", err, s.Get("d"))
+    }
+}
+
+func TestNewViewBatcher(t *testing.T) {
+    st := &batchSession{transientSession: newTransientSession("sid1")}
+    view, commit := NewView(st)
+    if err := commit(); err != nil || st.applies != 0 {
+        t.Fatalf("commit without changes = %v with %d applies, want none", err, st.applies)
+    }
+    view.Set("a", 1)
+    view.Set("b", 2)
+    view.Delete("c")
+    if err := commit(); err != nil {
+        t.Fatalf("commit: %v", err)
+    }
+    if st.applies != 1 || st.Get("a") != 1 || st.Get("b") != 2 {
+        t.Fatalf("%d applies leaving %v, want the changes in one", st.applies, st.Snapshot())
+    }
+}